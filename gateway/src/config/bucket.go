@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type ReadPolicy string
+
+const (
+	ReadPublic        ReadPolicy = "public"
+	ReadAuthenticated ReadPolicy = "authenticated"
+	ReadSigned        ReadPolicy = "signed"
+)
+
+// BucketConfig holds the per-bucket settings read from
+// $SECRETS_PATH/<bucket>/bucket.json, next to the backup credentials.
+type BucketConfig struct {
+	Read       ReadPolicy       `json:"read"`
+	Transforms *TransformConfig `json:"transforms,omitempty"`
+	// Profile names the optimization profile used for uploads without one
+	Profile string `json:"profile,omitempty"`
+	// KeepOriginals stores the untouched upload next to the optimized object
+	KeepOriginals bool `json:"keepOriginals,omitempty"`
+	// HLS transcodes uploaded videos into an adaptive streaming ladder
+	HLS bool `json:"hls,omitempty"`
+	// Versioning keeps the previous version of an object on overwrite and delete
+	Versioning bool `json:"versioning,omitempty"`
+	// SoftDelete moves deleted objects to the trash, where they can be
+	// restored until TrashRetention (a duration, TRASH_RETENTION by default) passed
+	SoftDelete     bool   `json:"softDelete,omitempty"`
+	TrashRetention string `json:"trashRetention,omitempty"`
+	// CacheMaxAge (a duration, CACHE_MAX_AGE by default) is how long clients
+	// may cache an object without revalidating it, overwrites show up after it
+	CacheMaxAge string `json:"cacheMaxAge,omitempty"`
+	// Lifecycle rules expire objects automatically
+	Lifecycle []*LifecycleRule `json:"lifecycle,omitempty"`
+	// PrimaryBudget caps the bytes of the bucket kept in the primary store.
+	// Least recently downloaded objects with a backup are evicted beyond it
+	// and served from the backups again when requested.
+	PrimaryBudget int64 `json:"primaryBudget,omitempty"`
+	// Replication writes uploads to the backups synchronously
+	Replication *ReplicationConfig `json:"replication,omitempty"`
+	// BackupPriority orders the backups read on a miss, e.g. ["s3", "firebase"].
+	// Healthy backups come first, unlisted ones after the listed ones.
+	BackupPriority []string `json:"backupPriority,omitempty"`
+
+	trashRetention time.Duration
+	cacheMaxAge    time.Duration
+}
+
+// ReplicationConfig makes a client upload succeed only once Quorum stores, the
+// primary store included, acknowledged it. The primary store must always
+// succeed as downloads are served from it, and Quorum cannot exceed the
+// number of backups plus one.
+type ReplicationConfig struct {
+	Quorum int `json:"quorum"`
+}
+
+// TransformConfig allowlists the on-the-fly image variants of a bucket, so
+// clients cannot fill the store with arbitrary sizes. Sizes are "WxH" with 0
+// for a dimension derived from the aspect ratio.
+type TransformConfig struct {
+	Sizes     []string `json:"sizes"`
+	Qualities []int    `json:"qualities"`
+}
+
+func (c *BucketConfig) IsPrivate() bool {
+	return c.Read != ReadPublic
+}
+
+// GetCacheMaxAge returns how long downloads may be cached without revalidation.
+func (c *BucketConfig) GetCacheMaxAge() time.Duration {
+	if c.cacheMaxAge > 0 {
+		return c.cacheMaxAge
+	}
+	maxAge, err := time.ParseDuration(GetSafeEnv(CacheMaxAge))
+	if err != nil {
+		return defaultCacheMaxAge
+	}
+	return maxAge
+}
+
+// GetTrashRetention returns how long deleted objects stay in the trash.
+func (c *BucketConfig) GetTrashRetention() time.Duration {
+	if c.trashRetention > 0 {
+		return c.trashRetention
+	}
+	retention, err := time.ParseDuration(GetSafeEnv(TrashRetention))
+	if err != nil {
+		return defaultTrashRetention
+	}
+	return retention
+}
+
+type cachedBucketConfig struct {
+	modTime time.Time
+	config  *BucketConfig
+}
+
+var bucketConfigs sync.Map
+
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+const defaultCacheMaxAge = time.Hour
+
+func defaultBucketConfig() *BucketConfig {
+	return &BucketConfig{Read: ReadPublic}
+}
+
+// GetBucketConfig returns the bucket settings, falling back to the defaults
+// when the bucket has no bucket.json. Parsed files are cached until they
+// change on disk.
+func GetBucketConfig(bucket string) (*BucketConfig, error) {
+	configPath := path.Join(GetSafeEnv(SecretsPath), bucket, "bucket.json")
+	info, err := os.Stat(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultBucketConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := bucketConfigs.Load(bucket); ok && cached.(*cachedBucketConfig).modTime.Equal(info.ModTime()) {
+		return cached.(*cachedBucketConfig).config, nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	bucketConfig := defaultBucketConfig()
+	if err = json.Unmarshal(data, bucketConfig); err != nil {
+		return nil, err
+	}
+	switch bucketConfig.Read {
+	case ReadPublic, ReadAuthenticated, ReadSigned:
+	default:
+		return nil, errors.New("invalid read policy: " + string(bucketConfig.Read))
+	}
+	if bucketConfig.TrashRetention != "" {
+		if bucketConfig.trashRetention, err = time.ParseDuration(bucketConfig.TrashRetention); err != nil || bucketConfig.trashRetention <= 0 {
+			return nil, errors.New("invalid trash retention: " + bucketConfig.TrashRetention)
+		}
+	}
+	if bucketConfig.CacheMaxAge != "" {
+		if bucketConfig.cacheMaxAge, err = time.ParseDuration(bucketConfig.CacheMaxAge); err != nil || bucketConfig.cacheMaxAge <= 0 {
+			return nil, errors.New("invalid cache max age: " + bucketConfig.CacheMaxAge)
+		}
+	}
+	if bucketConfig.Replication != nil {
+		// The quorum counts the primary store and every backup of the bucket
+		backups, err := GetAvailableSecrets(bucket)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if quorum := bucketConfig.Replication.Quorum; quorum < 1 || quorum > len(backups)+1 {
+			return nil, errors.New("invalid replication quorum: " + strconv.Itoa(quorum) + " with " + strconv.Itoa(len(backups)) + " backups")
+		}
+	}
+	for i, rule := range bucketConfig.Lifecycle {
+		if err = rule.validate(i); err != nil {
+			return nil, err
+		}
+	}
+
+	bucketConfigs.Store(bucket, &cachedBucketConfig{modTime: info.ModTime(), config: bucketConfig})
+	return bucketConfig, nil
+}
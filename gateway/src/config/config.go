@@ -53,6 +53,22 @@ func GetAvailableSecrets(bucket string) ([]string, error) {
 	return secrets, err
 }
 
+// GetBuckets returns the buckets with a directory in $SECRETS_PATH, the ones
+// that can have settings and backups.
+func GetBuckets() ([]string, error) {
+	entries, err := os.ReadDir(GetSafeEnv(SecretsPath))
+	if err != nil {
+		return nil, err
+	}
+	buckets := []string{}
+	for _, dir := range entries {
+		if dir.IsDir() {
+			buckets = append(buckets, dir.Name())
+		}
+	}
+	return buckets, nil
+}
+
 func GetFirebaseConfigFromPath(bucket string) (string, string, string, error) {
 	secretsPath := GetSafeEnv(SecretsPath)
 	firebaseConfigPath := path.Join(secretsPath, bucket, "firebase.json")
@@ -34,6 +34,34 @@ var (
 		"key":          "ADMIN_ACCESS_TOKEN",
 		"defaultValue": "admin@123",
 	}
+	ApiKeysPath = map[string]string{
+		"key":          "API_KEYS_PATH",
+		"defaultValue": "",
+	}
+	JwtKeysPath = map[string]string{
+		"key":          "JWT_KEYS_PATH",
+		"defaultValue": "",
+	}
+	JwtAudience = map[string]string{
+		"key":          "JWT_AUDIENCE",
+		"defaultValue": "",
+	}
+	JwtIssuer = map[string]string{
+		"key":          "JWT_ISSUER",
+		"defaultValue": "",
+	}
+	JwtAccessClaim = map[string]string{
+		"key":          "JWT_ACCESS_CLAIM",
+		"defaultValue": "storage",
+	}
+	OptimizationProfilesPath = map[string]string{
+		"key":          "OPTIMIZATION_PROFILES_PATH",
+		"defaultValue": "",
+	}
+	UrlSigningKey = map[string]string{
+		"key":          "URL_SIGNING_KEY",
+		"defaultValue": "",
+	}
 	SecretsPath = map[string]string{
 		"key":          "SECRETS_PATH",
 		"defaultValue": path.Join(getHomeDir(), "projects", "storage-gateway", "secrets"),
@@ -46,4 +74,52 @@ var (
 		"key":          "ASYNQ_REDIS_URL",
 		"defaultValue": "localhost:6379",
 	}
+	InternalBucket = map[string]string{
+		"key":          "INTERNAL_BUCKET",
+		"defaultValue": "storage-gateway",
+	}
+	TusExpiration = map[string]string{
+		"key":          "TUS_EXPIRATION",
+		"defaultValue": "24h",
+	}
+	TrashRetention = map[string]string{
+		"key":          "TRASH_RETENTION",
+		"defaultValue": "720h",
+	}
+	CacheMaxAge = map[string]string{
+		"key":          "CACHE_MAX_AGE",
+		"defaultValue": "1h",
+	}
+	TusReapSchedule = map[string]string{
+		"key":          "TUS_REAP_SCHEDULE",
+		"defaultValue": "@hourly",
+	}
+	TrashPurgeSchedule = map[string]string{
+		"key":          "TRASH_PURGE_SCHEDULE",
+		"defaultValue": "@hourly",
+	}
+	LifecycleSchedule = map[string]string{
+		"key":          "LIFECYCLE_SCHEDULE",
+		"defaultValue": "@daily",
+	}
+	EvictionSchedule = map[string]string{
+		"key":          "EVICTION_SCHEDULE",
+		"defaultValue": "@every 15m",
+	}
+	BackupHedgeDelay = map[string]string{
+		"key":          "BACKUP_HEDGE_DELAY",
+		"defaultValue": "300ms",
+	}
+	BackupBreakerFailures = map[string]string{
+		"key":          "BACKUP_BREAKER_FAILURES",
+		"defaultValue": "5",
+	}
+	BackupBreakerCooldown = map[string]string{
+		"key":          "BACKUP_BREAKER_COOLDOWN",
+		"defaultValue": "30s",
+	}
+	SecretsWatchInterval = map[string]string{
+		"key":          "SECRETS_WATCH_INTERVAL",
+		"defaultValue": "10s",
+	}
 )
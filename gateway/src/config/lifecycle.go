@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LifecycleRule expires the objects of a bucket matching all of its
+// conditions. Rules are applied by a periodic worker task.
+type LifecycleRule struct {
+	ID     string `json:"id"`
+	Prefix string `json:"prefix,omitempty"`
+	// ContentType matches exactly, or a whole type with "image/*"
+	ContentType string `json:"contentType,omitempty"`
+	// Age is the Go duration since the object was last written
+	Age string `json:"age"`
+	// Metadata entries the object must carry with the same values
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Backups also expires the object from the backup backends
+	Backups bool `json:"backups,omitempty"`
+
+	age time.Duration
+}
+
+func (r *LifecycleRule) validate(index int) error {
+	if r.ID == "" {
+		r.ID = "rule-" + strconv.Itoa(index)
+	}
+	age, err := time.ParseDuration(r.Age)
+	if err != nil || age <= 0 {
+		return errors.New("invalid lifecycle age for " + r.ID + ": " + r.Age)
+	}
+	r.age = age
+	return nil
+}
+
+// Matches reports whether an object matches the rule's prefix, content type
+// and age. Metadata is checked separately as listings do not return it.
+func (r *LifecycleRule) Matches(key string, contentType string, modified time.Time, now time.Time) bool {
+	if !strings.HasPrefix(key, r.Prefix) || now.Sub(modified) < r.age {
+		return false
+	}
+	if group, ok := strings.CutSuffix(r.ContentType, "/*"); ok {
+		return strings.HasPrefix(contentType, group+"/")
+	}
+	return r.ContentType == "" || r.ContentType == contentType
+}
+
+func (r *LifecycleRule) MatchesMetadata(metadata map[string]string) bool {
+	for name, value := range r.Metadata {
+		if metadata[name] != value {
+			return false
+		}
+	}
+	return true
+}
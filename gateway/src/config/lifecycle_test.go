@@ -0,0 +1,91 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLifecycleRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    LifecycleRule
+		wantID  string
+		wantErr bool
+	}{
+		{name: "named", rule: LifecycleRule{ID: "tmp", Age: "24h"}, wantID: "tmp"},
+		{name: "unnamed", rule: LifecycleRule{Age: "30m"}, wantID: "rule-2"},
+		{name: "missing age", rule: LifecycleRule{ID: "tmp"}, wantErr: true},
+		{name: "days are not a Go duration", rule: LifecycleRule{ID: "tmp", Age: "30d"}, wantErr: true},
+		{name: "zero age", rule: LifecycleRule{ID: "tmp", Age: "0s"}, wantErr: true},
+		{name: "negative age", rule: LifecycleRule{ID: "tmp", Age: "-1h"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.validate(2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && tt.rule.ID != tt.wantID {
+				t.Errorf("ID = %q, want %q", tt.rule.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestLifecycleRuleMatches(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+	tests := []struct {
+		name        string
+		rule        LifecycleRule
+		key         string
+		contentType string
+		modified    time.Time
+		want        bool
+	}{
+		{name: "any object old enough", rule: LifecycleRule{Age: "24h"}, key: "a.txt", contentType: "text/plain", modified: old, want: true},
+		{name: "too recent", rule: LifecycleRule{Age: "24h"}, key: "a.txt", contentType: "text/plain", modified: now.Add(-time.Hour), want: false},
+		{name: "exactly the age", rule: LifecycleRule{Age: "24h"}, key: "a.txt", modified: now.Add(-24 * time.Hour), want: true},
+		{name: "under prefix", rule: LifecycleRule{Prefix: "tmp/", Age: "24h"}, key: "tmp/a.txt", modified: old, want: true},
+		{name: "outside prefix", rule: LifecycleRule{Prefix: "tmp/", Age: "24h"}, key: "tmpfile.txt", modified: old, want: false},
+		{name: "exact content type", rule: LifecycleRule{ContentType: "video/mp4", Age: "24h"}, key: "a.mp4", contentType: "video/mp4", modified: old, want: true},
+		{name: "other content type", rule: LifecycleRule{ContentType: "video/mp4", Age: "24h"}, key: "a.mov", contentType: "video/quicktime", modified: old, want: false},
+		{name: "content type group", rule: LifecycleRule{ContentType: "image/*", Age: "24h"}, key: "a.png", contentType: "image/png", modified: old, want: true},
+		{name: "outside content type group", rule: LifecycleRule{ContentType: "image/*", Age: "24h"}, key: "a.mp4", contentType: "video/mp4", modified: old, want: false},
+		{name: "group is not a prefix match", rule: LifecycleRule{ContentType: "image/*", Age: "24h"}, key: "a", contentType: "imagery/x", modified: old, want: false},
+		{name: "unknown content type", rule: LifecycleRule{ContentType: "image/*", Age: "24h"}, key: "a.png", contentType: "", modified: old, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.validate(0); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.rule.Matches(tt.key, tt.contentType, tt.modified, now); got != tt.want {
+				t.Errorf("Matches(%q, %q) = %v, want %v", tt.key, tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLifecycleRuleMatchesMetadata(t *testing.T) {
+	rule := LifecycleRule{Metadata: map[string]string{"temporary": "true", "source": "import"}}
+	tests := []struct {
+		name     string
+		rule     LifecycleRule
+		metadata map[string]string
+		want     bool
+	}{
+		{name: "no metadata condition", rule: LifecycleRule{}, metadata: nil, want: true},
+		{name: "all entries", rule: rule, metadata: map[string]string{"temporary": "true", "source": "import", "other": "x"}, want: true},
+		{name: "one entry differs", rule: rule, metadata: map[string]string{"temporary": "false", "source": "import"}, want: false},
+		{name: "one entry missing", rule: rule, metadata: map[string]string{"temporary": "true"}, want: false},
+		{name: "no metadata", rule: rule, metadata: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.MatchesMetadata(tt.metadata); got != tt.want {
+				t.Errorf("MatchesMetadata(%v) = %v, want %v", tt.metadata, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultProfile  = "default"
+	DisabledProfile = "disabled"
+)
+
+var ErrUnknownProfile = errors.New("unknown optimization profile")
+
+type ImageProfile struct {
+	Quality      int  `json:"quality"`
+	MaxWidth     int  `json:"maxWidth"`
+	MaxHeight    int  `json:"maxHeight"`
+	KeepMetadata bool `json:"keepMetadata"`
+}
+
+type VideoProfile struct {
+	Codec        string `json:"codec"`
+	Preset       string `json:"preset"`
+	CRF          int    `json:"crf"`
+	MaxWidth     int    `json:"maxWidth"`
+	MaxHeight    int    `json:"maxHeight"`
+	AudioCodec   string `json:"audioCodec"`
+	AudioBitrate string `json:"audioBitrate"`
+	KeepMetadata bool   `json:"keepMetadata"`
+}
+
+// OptimizationProfile controls how uploaded media is compressed. Files
+// smaller than Threshold bytes are stored untouched.
+type OptimizationProfile struct {
+	Disabled  bool         `json:"disabled"`
+	Threshold int64        `json:"threshold"`
+	Image     ImageProfile `json:"image"`
+	Video     VideoProfile `json:"video"`
+}
+
+// Optimizes reports whether uploads of the content type are changed by the
+// profile.
+func (p *OptimizationProfile) Optimizes(contentType string) bool {
+	if p.Disabled {
+		return false
+	}
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/")
+}
+
+func defaultProfile() OptimizationProfile {
+	return OptimizationProfile{
+		Threshold: 500 * 1024,
+		Image: ImageProfile{
+			Quality: 75,
+		},
+		Video: VideoProfile{
+			Codec:        "libx264",
+			Preset:       "slow",
+			CRF:          26,
+			MaxWidth:     1920,
+			MaxHeight:    1080,
+			AudioCodec:   "aac",
+			AudioBitrate: "128k",
+		},
+	}
+}
+
+var profiles = struct {
+	sync.Mutex
+	modTime  time.Time
+	profiles map[string]*OptimizationProfile
+}{}
+
+func profilesPath() string {
+	if profilesPath := GetSafeEnv(OptimizationProfilesPath); profilesPath != "" {
+		return profilesPath
+	}
+	return path.Join(GetSafeEnv(SecretsPath), "profiles.json")
+}
+
+// loadProfiles reads the named profiles, a JSON object of profile name to
+// profile. Fields left out of a profile keep the default values.
+func loadProfiles() (map[string]*OptimizationProfile, error) {
+	profiles.Lock()
+	defer profiles.Unlock()
+
+	info, err := os.Stat(profilesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]*OptimizationProfile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if profiles.profiles != nil && info.ModTime().Equal(profiles.modTime) {
+		return profiles.profiles, nil
+	}
+
+	data, err := os.ReadFile(profilesPath())
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]json.RawMessage{}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	loaded := map[string]*OptimizationProfile{}
+	for name, profileData := range raw {
+		profile := defaultProfile()
+		if err = json.Unmarshal(profileData, &profile); err != nil {
+			return nil, err
+		}
+		loaded[name] = &profile
+	}
+
+	profiles.profiles, profiles.modTime = loaded, info.ModTime()
+	return loaded, nil
+}
+
+// GetOptimizationProfile returns a named profile. The "default" and
+// "disabled" profiles always exist, "default" can be overridden in the
+// profiles file.
+func GetOptimizationProfile(name string) (*OptimizationProfile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	if name == DisabledProfile {
+		return &OptimizationProfile{Disabled: true}, nil
+	}
+	loaded, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+	if profile, ok := loaded[name]; ok {
+		return profile, nil
+	}
+	if name == DefaultProfile {
+		profile := defaultProfile()
+		return &profile, nil
+	}
+	return nil, ErrUnknownProfile
+}
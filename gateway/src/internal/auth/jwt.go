@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/storage-gateway/src/config"
+)
+
+// jwtLeeway tolerates clock skew between the token issuer and the gateway
+const jwtLeeway = 60 * time.Second
+
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// jwk is a JSON Web Key, only the members needed for HS256 ("oct"),
+// RS256 ("RSA") and EdDSA ("OKP" with Ed25519) keys are decoded.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+type jwtKey struct {
+	kid string
+	alg string
+	// one of []byte, *rsa.PublicKey or ed25519.PublicKey
+	key any
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+}
+
+// keySet holds the keys loaded from JWT_KEYS_PATH, a JWK Set file that is
+// reloaded whenever it changes on disk.
+type keySet struct {
+	mu      sync.RWMutex
+	modTime time.Time
+	keys    []jwtKey
+}
+
+var jwtKeys = &keySet{}
+
+func b64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func (k *jwk) parse() (jwtKey, error) {
+	parsed := jwtKey{kid: k.Kid, alg: k.Alg}
+	switch k.Kty {
+	case "oct":
+		secret, err := b64(k.K)
+		if err != nil {
+			return parsed, err
+		}
+		parsed.key, parsed.alg = secret, "HS256"
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return parsed, err
+		}
+		e, err := b64(k.E)
+		if err != nil {
+			return parsed, err
+		}
+		parsed.key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		parsed.alg = "RS256"
+	case "OKP":
+		x, err := b64(k.X)
+		if err != nil {
+			return parsed, err
+		}
+		if k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return parsed, errors.New("unsupported OKP key")
+		}
+		parsed.key, parsed.alg = ed25519.PublicKey(x), "EdDSA"
+	default:
+		return parsed, errors.New("unsupported key type: " + k.Kty)
+	}
+	if k.Alg != "" && k.Alg != parsed.alg {
+		return parsed, errors.New("unsupported key algorithm: " + k.Alg)
+	}
+	return parsed, nil
+}
+
+func (s *keySet) load() ([]jwtKey, error) {
+	keysPath := config.GetSafeEnv(config.JwtKeysPath)
+	if keysPath == "" {
+		return nil, nil
+	}
+	info, err := os.Stat(keysPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	if info.ModTime().Equal(s.modTime) {
+		defer s.mu.RUnlock()
+		return s.keys, nil
+	}
+	s.mu.RUnlock()
+
+	data, err := os.ReadFile(keysPath)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := []jwtKey{}
+	for _, k := range set.Keys {
+		parsed, err := k.parse()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, parsed)
+	}
+
+	s.mu.Lock()
+	s.keys, s.modTime = keys, info.ModTime()
+	s.mu.Unlock()
+	return keys, nil
+}
+
+func verifySignature(key jwtKey, signingInput string, signature []byte) bool {
+	switch k := key.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case *rsa.PublicKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, []byte(signingInput), signature)
+	}
+	return false
+}
+
+func (c *jwtClaims) audiences() []string {
+	var single string
+	if json.Unmarshal(c.Audience, &single) == nil {
+		return []string{single}
+	}
+	var many []string
+	json.Unmarshal(c.Audience, &many)
+	return many
+}
+
+// VerifyJWT validates a compact JWS signed with HS256, RS256 or EdDSA against
+// the configured key set, checks exp, nbf, aud and iss, and maps the access
+// claim (JWT_ACCESS_CLAIM) to a principal. The claim has the same shape as an
+// API key scope: {"buckets": [...], "prefixes": [...], "operations": [...]}.
+func VerifyJWT(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	headerData, err := b64(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var header jwtHeader
+	if err = json.Unmarshal(headerData, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	signature, err := b64(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	keys, err := jwtKeys.load()
+	if err != nil {
+		return nil, err
+	}
+	verified := false
+	for _, key := range keys {
+		// The algorithm is fixed by the key, never by the token header
+		if key.alg != header.Alg || (header.Kid != "" && key.kid != "" && key.kid != header.Kid) {
+			continue
+		}
+		if verifySignature(key, parts[0]+"."+parts[1], signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := b64(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims jwtClaims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now()
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return nil, ErrInvalidToken
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return nil, ErrInvalidToken
+	}
+	if audience := config.GetSafeEnv(config.JwtAudience); audience != "" && !slices.Contains(claims.audiences(), audience) {
+		return nil, ErrInvalidToken
+	}
+	if issuer := config.GetSafeEnv(config.JwtIssuer); issuer != "" && claims.Issuer != issuer {
+		return nil, ErrInvalidToken
+	}
+
+	var access map[string]json.RawMessage
+	if err = json.Unmarshal(payload, &access); err != nil {
+		return nil, ErrInvalidToken
+	}
+	principal := &Principal{}
+	if scope, ok := access[config.GetSafeEnv(config.JwtAccessClaim)]; ok {
+		if err = json.Unmarshal(scope, principal); err != nil {
+			return nil, ErrInvalidToken
+		}
+	}
+	principal.ID = "jwt:" + claims.Subject
+	return principal, nil
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret                     = []byte("0123456789abcdef0123456789abcdef")
+	testEdPublic, testEdPrivate, _ = ed25519.GenerateKey(rand.Reader)
+)
+
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signHS256 builds a token whose signature is an HMAC with secret, whatever
+// alg the header names.
+func signHS256(t *testing.T, header map[string]any, claims map[string]any, secret []byte) string {
+	signingInput := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signEdDSA(t *testing.T, header map[string]any, claims map[string]any) string {
+	signingInput := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(testEdPrivate, []byte(signingInput)))
+}
+
+// setupKeys writes a key set with an HS256 key "hmac" and an Ed25519 key "ed".
+func setupKeys(t *testing.T) {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hmac", "k": base64.RawURLEncoding.EncodeToString(testSecret)},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(testEdPublic)},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_KEYS_PATH", path)
+	t.Setenv("JWT_AUDIENCE", "gateway")
+	t.Setenv("JWT_ISSUER", "https://issuer.example")
+	t.Setenv("JWT_ACCESS_CLAIM", "storage")
+}
+
+func TestVerifyJWT(t *testing.T) {
+	setupKeys(t)
+	now := time.Now().Unix()
+	scope := map[string]any{"buckets": []string{"media"}, "prefixes": []string{"users/1/"}, "operations": []string{"read", "write"}}
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{"sub": "user-1", "iss": "https://issuer.example", "aud": "gateway", "exp": now + 300, "storage": scope}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	hs256 := map[string]any{"alg": "HS256", "kid": "hmac"}
+	edDSA := map[string]any{"alg": "EdDSA", "kid": "ed"}
+	scoped := &Principal{
+		ID:         "jwt:user-1",
+		Buckets:    []string{"media"},
+		Prefixes:   []string{"users/1/"},
+		Operations: []Operation{OpRead, OpWrite},
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  *Principal
+	}{
+		{name: "HS256", token: signHS256(t, hs256, claims(nil), testSecret), want: scoped},
+		{name: "EdDSA", token: signEdDSA(t, edDSA, claims(nil)), want: scoped},
+		{name: "without kid", token: signHS256(t, map[string]any{"alg": "HS256"}, claims(nil), testSecret), want: scoped},
+		{name: "audience list", token: signHS256(t, hs256, claims(map[string]any{"aud": []string{"other", "gateway"}}), testSecret), want: scoped},
+		{name: "no access claim", token: signHS256(t, hs256, claims(map[string]any{"storage": nil}), testSecret), want: &Principal{ID: "jwt:user-1"}},
+		{name: "expired within leeway", token: signHS256(t, hs256, claims(map[string]any{"exp": now - 30}), testSecret), want: scoped},
+		{name: "expired", token: signHS256(t, hs256, claims(map[string]any{"exp": now - 120}), testSecret)},
+		{name: "no exp", token: signHS256(t, hs256, claims(map[string]any{"exp": nil}), testSecret)},
+		{name: "not yet valid", token: signHS256(t, hs256, claims(map[string]any{"nbf": now + 300}), testSecret)},
+		{name: "wrong audience", token: signHS256(t, hs256, claims(map[string]any{"aud": "other"}), testSecret)},
+		{name: "wrong issuer", token: signHS256(t, hs256, claims(map[string]any{"iss": "https://evil.example"}), testSecret)},
+		{name: "wrong secret", token: signHS256(t, hs256, claims(nil), []byte("another secret"))},
+		{name: "unknown kid", token: signHS256(t, map[string]any{"alg": "HS256", "kid": "other"}, claims(nil), testSecret)},
+		{name: "malformed scope", token: signHS256(t, hs256, claims(map[string]any{"storage": "everything"}), testSecret)},
+		// The algorithm comes from the key, the header cannot switch it
+		{name: "HMAC with the public key", token: signHS256(t, map[string]any{"alg": "HS256", "kid": "ed"}, claims(nil), testEdPublic)},
+		{name: "HS256 key named EdDSA", token: signHS256(t, map[string]any{"alg": "EdDSA", "kid": "hmac"}, claims(nil), testSecret)},
+		{name: "alg none", token: encodeSegment(t, map[string]any{"alg": "none"}) + "." + encodeSegment(t, claims(nil)) + "."},
+		{name: "two segments", token: encodeSegment(t, hs256) + "." + encodeSegment(t, claims(nil))},
+		{name: "not base64", token: "!!.!!.!!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyJWT(tt.token)
+			if tt.want == nil {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("VerifyJWT() = %+v, %v, want %v", got, err, ErrInvalidToken)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyJWT() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VerifyJWT() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     jwk
+		wantAlg string
+		wantErr bool
+	}{
+		{name: "oct", key: jwk{Kty: "oct", K: "c2VjcmV0"}, wantAlg: "HS256"},
+		{name: "oct with alg", key: jwk{Kty: "oct", Alg: "HS256", K: "c2VjcmV0"}, wantAlg: "HS256"},
+		{name: "RSA", key: jwk{Kty: "RSA", N: "AQAB", E: "AQAB"}, wantAlg: "RS256"},
+		{name: "Ed25519", key: jwk{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(testEdPublic)}, wantAlg: "EdDSA"},
+		{name: "other curve", key: jwk{Kty: "OKP", Crv: "X25519", X: base64.RawURLEncoding.EncodeToString(testEdPublic)}, wantErr: true},
+		{name: "unsupported alg", key: jwk{Kty: "oct", Alg: "HS512", K: "c2VjcmV0"}, wantErr: true},
+		{name: "RSA named HS256", key: jwk{Kty: "RSA", Alg: "HS256", N: "AQAB", E: "AQAB"}, wantErr: true},
+		{name: "unsupported type", key: jwk{Kty: "EC"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.key.parse()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.alg != tt.wantAlg {
+				t.Errorf("parse() alg = %q, want %q", got.alg, tt.wantAlg)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/storage-gateway/src/config"
+)
+
+const keyPrefix = "sgw_"
+
+var (
+	ErrInvalidKey  = errors.New("invalid api key")
+	ErrKeyNotFound = errors.New("api key not found")
+)
+
+// APIKey is a stored key. Only the SHA-256 hash of the secret is kept, the
+// secret itself is returned once when the key is created or rotated.
+type APIKey struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Hash       string      `json:"hash,omitempty"`
+	Buckets    []string    `json:"buckets"`
+	Prefixes   []string    `json:"prefixes"`
+	Operations []Operation `json:"operations"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	RotatedAt  *time.Time  `json:"rotatedAt,omitempty"`
+}
+
+func (k *APIKey) Principal() *Principal {
+	return &Principal{
+		ID:         k.ID,
+		Buckets:    k.Buckets,
+		Prefixes:   k.Prefixes,
+		Operations: k.Operations,
+	}
+}
+
+// KeyStore keeps API keys in a JSON file. The file is reloaded when it is
+// changed on disk, so keys edited by another gateway instance are picked up.
+type KeyStore struct {
+	mu      sync.RWMutex
+	path    string
+	modTime time.Time
+	keys    []*APIKey
+}
+
+var keyStore *KeyStore
+
+func InitKeyStore() (*KeyStore, error) {
+	keysPath := config.GetSafeEnv(config.ApiKeysPath)
+	if keysPath == "" {
+		keysPath = path.Join(config.GetSafeEnv(config.SecretsPath), "api_keys.json")
+	}
+	keyStore = &KeyStore{path: keysPath, keys: []*APIKey{}}
+	return keyStore, keyStore.reload()
+}
+
+func GetKeyStore() *KeyStore {
+	return keyStore
+}
+
+func (s *KeyStore) reload() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	keys := []*APIKey{}
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.modTime = info.ModTime()
+	s.mu.Unlock()
+	return nil
+}
+
+// save writes the keys to a temporary file and renames it, so readers never
+// see a partially written file. Callers hold the write lock.
+func (s *KeyStore) save() error {
+	data, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(path.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func newSecret(id string) (string, string, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return keyPrefix + id + "." + secret, hashSecret(secret), nil
+}
+
+// Authenticate resolves a token of the form "sgw_<id>.<secret>" to its
+// principal, comparing the secret hash in constant time.
+func (s *KeyStore) Authenticate(token string) (*Principal, error) {
+	rest, ok := strings.CutPrefix(token, keyPrefix)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	id, secret, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hash := hashSecret(secret)
+	for _, key := range s.keys {
+		if key.ID == id && subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) == 1 {
+			return key.Principal(), nil
+		}
+	}
+	return nil, ErrInvalidKey
+}
+
+// Create stores a new key and returns it along with its token.
+func (s *KeyStore) Create(key *APIKey) (*APIKey, string, error) {
+	for _, op := range key.Operations {
+		if !op.Valid() {
+			return nil, "", errors.New("invalid operation: " + string(op))
+		}
+	}
+	if err := s.reload(); err != nil {
+		return nil, "", err
+	}
+	id, err := randomString(9)
+	if err != nil {
+		return nil, "", err
+	}
+	token, hash, err := newSecret(id)
+	if err != nil {
+		return nil, "", err
+	}
+	key.ID = id
+	key.Hash = hash
+	key.CreatedAt = time.Now().UTC()
+	key.RotatedAt = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	if err = s.save(); err != nil {
+		s.keys = s.keys[:len(s.keys)-1]
+		return nil, "", err
+	}
+	return key.public(), token, nil
+}
+
+func (s *KeyStore) List() ([]*APIKey, error) {
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]*APIKey, len(s.keys))
+	for i, key := range s.keys {
+		keys[i] = key.public()
+	}
+	return keys, nil
+}
+
+// Rotate replaces the secret of a key, invalidating the previous token.
+func (s *KeyStore) Rotate(id string) (*APIKey, string, error) {
+	if err := s.reload(); err != nil {
+		return nil, "", err
+	}
+	token, hash, err := newSecret(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.keys, func(k *APIKey) bool { return k.ID == id })
+	if i < 0 {
+		return nil, "", ErrKeyNotFound
+	}
+	previous := *s.keys[i]
+	now := time.Now().UTC()
+	s.keys[i].Hash = hash
+	s.keys[i].RotatedAt = &now
+	if err = s.save(); err != nil {
+		*s.keys[i] = previous
+		return nil, "", err
+	}
+	return s.keys[i].public(), token, nil
+}
+
+func (s *KeyStore) Revoke(id string) error {
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.keys, func(k *APIKey) bool { return k.ID == id })
+	if i < 0 {
+		return ErrKeyNotFound
+	}
+	previous := s.keys
+	s.keys = slices.Delete(slices.Clone(s.keys), i, i+1)
+	if err := s.save(); err != nil {
+		s.keys = previous
+		return err
+	}
+	return nil
+}
+
+func (k *APIKey) public() *APIKey {
+	key := *k
+	key.Hash = ""
+	return &key
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+type Operation string
+
+const (
+	OpRead   Operation = "read"
+	OpWrite  Operation = "write"
+	OpDelete Operation = "delete"
+	// OpAdmin grants every operation on every bucket, including key management.
+	OpAdmin Operation = "admin"
+)
+
+func (op Operation) Valid() bool {
+	switch op {
+	case OpRead, OpWrite, OpDelete, OpAdmin:
+		return true
+	}
+	return false
+}
+
+// Principal is an authenticated caller and what it may access. Empty Buckets
+// or Prefixes, or a "*" entry, allow any bucket or key.
+type Principal struct {
+	ID         string      `json:"id"`
+	Buckets    []string    `json:"buckets"`
+	Prefixes   []string    `json:"prefixes"`
+	Operations []Operation `json:"operations"`
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p != nil && slices.Contains(p.Operations, OpAdmin)
+}
+
+// Allows reports whether the principal may perform op on key in bucket. An
+// empty key only checks the bucket, callers must check the key once known.
+func (p *Principal) Allows(op Operation, bucket string, key string) bool {
+	if p == nil {
+		return false
+	}
+	if p.IsAdmin() {
+		return true
+	}
+	if !slices.Contains(p.Operations, op) {
+		return false
+	}
+	if len(p.Buckets) > 0 && !slices.Contains(p.Buckets, "*") && !slices.Contains(p.Buckets, bucket) {
+		return false
+	}
+	if key == "" || len(p.Prefixes) == 0 || slices.Contains(p.Prefixes, "*") {
+		return true
+	}
+	for _, prefix := range p.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsListing reports whether the principal may perform op on every key
+// under prefix in bucket, as listing them requires. Principals scoped to key
+// prefixes must list within one of them.
+func (p *Principal) AllowsListing(op Operation, bucket string, prefix string) bool {
+	if !p.Allows(op, bucket, "") {
+		return false
+	}
+	if p.IsAdmin() || len(p.Prefixes) == 0 || slices.Contains(p.Prefixes, "*") {
+		return true
+	}
+	for _, allowed := range p.Prefixes {
+		if strings.HasPrefix(prefix, allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package auth
+
+import "testing"
+
+func TestPrincipalAllows(t *testing.T) {
+	scoped := &Principal{
+		ID:         "scoped",
+		Buckets:    []string{"media"},
+		Prefixes:   []string{"users/1/", "public/"},
+		Operations: []Operation{OpRead, OpWrite},
+	}
+	tests := []struct {
+		name      string
+		principal *Principal
+		op        Operation
+		bucket    string
+		key       string
+		want      bool
+	}{
+		{name: "no principal", principal: nil, op: OpRead, bucket: "media", key: "a.jpg", want: false},
+		{name: "admin", principal: &Principal{Operations: []Operation{OpAdmin}, Buckets: []string{"other"}, Prefixes: []string{"x/"}}, op: OpDelete, bucket: "media", key: "a.jpg", want: true},
+		{name: "unscoped", principal: &Principal{Operations: []Operation{OpRead}}, op: OpRead, bucket: "media", key: "a.jpg", want: true},
+		{name: "wildcards", principal: &Principal{Buckets: []string{"*"}, Prefixes: []string{"*"}, Operations: []Operation{OpRead}}, op: OpRead, bucket: "any", key: "any/key", want: true},
+		{name: "operation not granted", principal: scoped, op: OpDelete, bucket: "media", key: "users/1/a.jpg", want: false},
+		{name: "other bucket", principal: scoped, op: OpRead, bucket: "backups", key: "users/1/a.jpg", want: false},
+		{name: "key under prefix", principal: scoped, op: OpRead, bucket: "media", key: "users/1/a.jpg", want: true},
+		{name: "key under second prefix", principal: scoped, op: OpWrite, bucket: "media", key: "public/b.png", want: true},
+		{name: "key of another user", principal: scoped, op: OpRead, bucket: "media", key: "users/10/a.jpg", want: false},
+		{name: "key equal to prefix without slash", principal: scoped, op: OpRead, bucket: "media", key: "users/1", want: false},
+		{name: "key outside prefixes", principal: scoped, op: OpRead, bucket: "media", key: "private/a.jpg", want: false},
+		{name: "bucket only", principal: scoped, op: OpRead, bucket: "media", key: "", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.Allows(tt.op, tt.bucket, tt.key); got != tt.want {
+				t.Errorf("Allows(%s, %q, %q) = %v, want %v", tt.op, tt.bucket, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalAllowsListing(t *testing.T) {
+	scoped := &Principal{
+		Buckets:    []string{"media"},
+		Prefixes:   []string{"users/1/"},
+		Operations: []Operation{OpRead},
+	}
+	tests := []struct {
+		name      string
+		principal *Principal
+		bucket    string
+		prefix    string
+		want      bool
+	}{
+		{name: "no principal", principal: nil, bucket: "media", prefix: "", want: false},
+		{name: "unscoped whole bucket", principal: &Principal{Operations: []Operation{OpRead}}, bucket: "media", prefix: "", want: true},
+		{name: "admin whole bucket", principal: &Principal{Operations: []Operation{OpAdmin}, Prefixes: []string{"x/"}}, bucket: "media", prefix: "", want: true},
+		{name: "scoped whole bucket", principal: scoped, bucket: "media", prefix: "", want: false},
+		{name: "scoped parent of prefix", principal: scoped, bucket: "media", prefix: "users/", want: false},
+		{name: "scoped partial prefix", principal: scoped, bucket: "media", prefix: "users/1", want: false},
+		{name: "scoped own prefix", principal: scoped, bucket: "media", prefix: "users/1/", want: true},
+		{name: "scoped below own prefix", principal: scoped, bucket: "media", prefix: "users/1/photos/", want: true},
+		{name: "scoped other bucket", principal: scoped, bucket: "backups", prefix: "users/1/", want: false},
+		{name: "operation not granted", principal: &Principal{Operations: []Operation{OpWrite}}, bucket: "media", prefix: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.AllowsListing(OpRead, tt.bucket, tt.prefix); got != tt.want {
+				t.Errorf("AllowsListing(read, %q, %q) = %v, want %v", tt.bucket, tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperationValid(t *testing.T) {
+	for _, op := range []Operation{OpRead, OpWrite, OpDelete, OpAdmin} {
+		if !op.Valid() {
+			t.Errorf("%q is not valid", op)
+		}
+	}
+	for _, op := range []Operation{"", "list", "READ"} {
+		if op.Valid() {
+			t.Errorf("%q is valid", op)
+		}
+	}
+}
@@ -2,30 +2,121 @@ package http
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"net/http"
+	"strings"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/internal/auth"
 )
 
+// adminPrincipal is the caller authenticated with ADMIN_ACCESS_TOKEN, kept as
+// a bootstrap credential to manage API keys.
+var adminPrincipal = &auth.Principal{ID: "admin", Operations: []auth.Operation{auth.OpAdmin}}
+
+func authenticate(token string) (*auth.Principal, error) {
+	adminToken := config.GetSafeEnv(config.AdminAccessToken)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+		return adminPrincipal, nil
+	}
+	return auth.GetKeyStore().Authenticate(token)
+}
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			principal, err := auth.VerifyJWT(strings.TrimSpace(bearer))
+			if err != nil {
+				writeError(w, r, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			ctx := context.WithValue(r.Context(), "principal", principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		token := r.Header.Get("X-Access-Token")
 		if token == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeError(w, r, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
 		decodedToken, decodeErr := base64.StdEncoding.DecodeString(token)
 		if decodeErr != nil {
-			http.Error(w, "Invalid token", http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, "Invalid token")
 			return
 		}
-		if string(decodedToken) != config.GetSafeEnv(config.AdminAccessToken) {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		principal, err := authenticate(string(decodedToken))
+		if err != nil {
+			writeError(w, r, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
-		ctx := context.WithValue(r.Context(), "token", string(decodedToken))
+		ctx := context.WithValue(r.Context(), "principal", principal)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// OptionalAuthMiddleware authenticates requests that carry credentials and
+// lets anonymous requests through, for routes whose access depends on the
+// bucket's read policy.
+func OptionalAuthMiddleware(next http.Handler) http.Handler {
+	auth := AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && r.Header.Get("X-Access-Token") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth.ServeHTTP(w, r)
+	})
+}
+
+// isInternalBucket reports whether bucket is INTERNAL_BUCKET, which holds
+// upload state, kept originals, versions and trash. It is never reachable
+// through the bucket routes, whatever the caller's credentials.
+func isInternalBucket(bucket string) bool {
+	return bucket == config.GetSafeEnv(config.InternalBucket)
+}
+
+func principalFromContext(ctx context.Context) *auth.Principal {
+	principal, _ := ctx.Value("principal").(*auth.Principal)
+	return principal
+}
+
+// RequireOperation rejects callers whose principal may not perform op on the
+// routed bucket and key. Requests made with a presigned URL are already scoped
+// by their signature and pass through.
+func RequireOperation(op auth.Operation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isInternalBucket(chi.URLParam(r, "bucket")) {
+				writeError(w, r, http.StatusForbidden, "Forbidden")
+				return
+			}
+			if signedURLFromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !principalFromContext(r.Context()).Allows(op, chi.URLParam(r, "bucket"), chi.URLParam(r, "*")) {
+				writeError(w, r, http.StatusForbidden, "Forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireListing rejects callers whose principal may not perform op on every
+// key under the listed ?prefix= of the routed bucket.
+func RequireListing(op auth.Operation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isInternalBucket(chi.URLParam(r, "bucket")) || !principalFromContext(r.Context()).AllowsListing(op, chi.URLParam(r, "bucket"), r.URL.Query().Get("prefix")) {
+				writeError(w, r, http.StatusForbidden, "Forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
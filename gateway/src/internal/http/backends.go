@@ -0,0 +1,13 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+// BackendHealth reports the health this gateway measured for each backup
+// backend, and which ones it currently skips.
+func (h *Handler) BackendHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, backends.Snapshot())
+}
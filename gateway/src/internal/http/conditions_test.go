@@ -0,0 +1,117 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/storage-gateway/src/storage"
+)
+
+func TestParseWriteConditions(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifMatch     string
+		ifNoneMatch string
+		want        storage.Conditions
+		wantErr     bool
+	}{
+		{name: "none"},
+		{name: "create only", ifNoneMatch: "*", want: storage.Conditions{IfNoneMatch: "*"}},
+		{name: "replace version", ifMatch: `"abc"`, want: storage.Conditions{IfMatch: `"abc"`}},
+		{name: "replace any", ifMatch: "*", want: storage.Conditions{IfMatch: "*"}},
+		{name: "If-None-Match with an ETag", ifNoneMatch: `"abc"`, wantErr: true},
+		{name: "both", ifMatch: `"abc"`, ifNoneMatch: "*", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/bucket/key", nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			got, err := parseWriteConditions(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWriteConditions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseWriteConditions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateWriteConditions(t *testing.T) {
+	current := &storage.ObjectInfo{Key: "key", ETag: `"abc"`}
+	tests := []struct {
+		name       string
+		conditions storage.Conditions
+		current    *storage.ObjectInfo
+		want       storage.Conditions
+		wantErr    error
+	}{
+		{name: "unconditional create", current: nil},
+		{name: "unconditional replace", current: current},
+		{name: "create only, missing", conditions: storage.Conditions{IfNoneMatch: "*"}, current: nil, want: storage.Conditions{IfNoneMatch: "*"}},
+		{name: "create only, exists", conditions: storage.Conditions{IfNoneMatch: "*"}, current: current, wantErr: storage.ErrPreconditionFailed},
+		{name: "matching ETag", conditions: storage.Conditions{IfMatch: `"abc"`}, current: current, want: storage.Conditions{IfMatch: `"abc"`}},
+		{name: "other ETag", conditions: storage.Conditions{IfMatch: `"def"`}, current: current, wantErr: storage.ErrPreconditionFailed},
+		{name: "ETag, missing", conditions: storage.Conditions{IfMatch: `"abc"`}, current: nil, wantErr: storage.ErrPreconditionFailed},
+		{name: "any, pinned", conditions: storage.Conditions{IfMatch: "*"}, current: current, want: storage.Conditions{IfMatch: `"abc"`}},
+		{name: "any, missing", conditions: storage.Conditions{IfMatch: "*"}, current: nil, wantErr: storage.ErrPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluateWriteConditions(tt.conditions, tt.current)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("evaluateWriteConditions() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got != tt.want {
+				t.Errorf("evaluateWriteConditions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCacheHeadersConditionalGet(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	file := &storage.GetObject{ContentType: "text/plain", ETag: `"abc"`, LastModified: modified}
+	tests := []struct {
+		name            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		want            int
+	}{
+		{name: "unconditional", want: http.StatusOK},
+		{name: "same ETag", ifNoneMatch: `"abc"`, want: http.StatusNotModified},
+		{name: "other ETag", ifNoneMatch: `"def"`, want: http.StatusOK},
+		{name: "ETag decides over date", ifNoneMatch: `"def"`, ifModifiedSince: modified.Add(time.Hour).Format(http.TimeFormat), want: http.StatusOK},
+		{name: "modified before date", ifModifiedSince: modified.Add(time.Hour).Format(http.TimeFormat), want: http.StatusNotModified},
+		{name: "modified at date", ifModifiedSince: modified.Format(http.TimeFormat), want: http.StatusNotModified},
+		{name: "modified after date", ifModifiedSince: modified.Add(-time.Hour).Format(http.TimeFormat), want: http.StatusOK},
+		{name: "invalid date", ifModifiedSince: "yesterday", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/bucket/key", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			if tt.ifModifiedSince != "" {
+				r.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+			w := httptest.NewRecorder()
+			done := writeCacheHeaders(w, r, file, false, false, time.Hour)
+			if done != (tt.want == http.StatusNotModified) || w.Code != tt.want {
+				t.Errorf("writeCacheHeaders() = %v with status %d, want status %d", done, w.Code, tt.want)
+			}
+			if got := w.Header().Get("ETag"); got != file.ETag {
+				t.Errorf("ETag = %q, want %q", got, file.ETag)
+			}
+		})
+	}
+}
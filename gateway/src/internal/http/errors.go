@@ -0,0 +1,80 @@
+package http
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/storage-gateway/src/storage"
+)
+
+type errorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// writeError writes an error with a JSON body. The request id lets clients
+// point at the matching log lines when reporting a problem.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	requestId := middleware.GetReqID(r.Context())
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Request-Id", requestId)
+	writeJSON(w, status, errorResponse{
+		Code:      strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"),
+		Message:   message,
+		RequestID: requestId,
+	})
+}
+
+// storageErrorStatus maps the storage error kinds to HTTP statuses.
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, storage.ErrAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, storage.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, storage.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, storage.ErrInvalidRange):
+		return http.StatusRequestedRangeNotSatisfiable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeStorageError writes the response for a failed storage operation. The
+// backend's message is only logged, clients get the message of the error kind.
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	status := storageErrorStatus(err)
+	if status == http.StatusInternalServerError || status == http.StatusServiceUnavailable || status == http.StatusForbidden {
+		slog.Error("storage operation failed", "method", r.Method, "path", r.URL.Path, "requestId", middleware.GetReqID(r.Context()), "error", err)
+	}
+
+	message := http.StatusText(status)
+	for _, kind := range []error{
+		storage.ErrNotFound,
+		storage.ErrAlreadyExists,
+		storage.ErrPreconditionFailed,
+		storage.ErrAccessDenied,
+		storage.ErrUnavailable,
+		storage.ErrTooLarge,
+		storage.ErrInvalidRange,
+	} {
+		if errors.Is(err, kind) {
+			message = kind.Error()
+			break
+		}
+	}
+	writeError(w, r, status, message)
+}
@@ -1,117 +1,426 @@
 package http
 
 import (
+	"bufio"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"mime/multipart"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/internal/auth"
 	"github.com/storage-gateway/src/internal/service"
 	"github.com/storage-gateway/src/processing"
 	"github.com/storage-gateway/src/queue"
 	"github.com/storage-gateway/src/storage"
 )
 
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+	maxMetadataSize  = 64 * 1024
+)
+
 type Handler struct {
-	files *service.FileService
+	files   *service.FileService
+	uploads *service.TusService
 }
 
-func NewHandler(files *service.FileService) *Handler {
-	return &Handler{files: files}
+func NewHandler(files *service.FileService, uploads *service.TusService) *Handler {
+	return &Handler{files: files, uploads: uploads}
 }
 
+// uploadResponse describes a stored upload. Job is the id of the optimization
+// task when the object is replaced by an optimized version in the background,
+// Replicas the outcome per store in buckets with replication.
+type uploadResponse struct {
+	*storage.PutOptions
+	Job      string                  `json:"job,omitempty"`
+	Replicas []service.ReplicaResult `json:"replicas,omitempty"`
+}
+
+// Upload stores a new object, it fails with 409 when the key is taken, even
+// if a concurrent upload of the same key stores it first.
 func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
 	key := chi.URLParam(r, "*")
 	ctx := r.Context()
 
-	if h.files.Exists(ctx, bucket, key) {
-		http.Error(w, "Key already exists", http.StatusBadRequest)
+	// An object evicted to the backups still takes the key
+	exists, err := h.files.ExistsOrEvicted(ctx, bucket, key)
+	if err != nil {
+		writeStorageError(w, r, err)
 		return
 	}
+	if exists {
+		writeStorageError(w, r, storage.ErrAlreadyExists)
+		return
+	}
+	h.receiveUpload(w, r, storage.Conditions{IfNoneMatch: "*"}, false, "")
+}
 
-	file, header, err := r.FormFile("file")
-	contentType := header.Header.Get("Content-Type")
-	isImageOrVideo := strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/")
-	if !isImageOrVideo {
-		buffer := make([]byte, 512)
-		n, _ := file.Read(buffer)
-		contentType = http.DetectContentType(buffer[:n])
-		file.Seek(0, io.SeekStart)
+// Replace stores an object whether the key exists or not. "If-None-Match: *"
+// only creates it and "If-Match" only replaces the object with that ETag, the
+// store checks both atomically. A failed condition is a 412.
+func (h *Handler) Replace(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := chi.URLParam(r, "*")
+	ctx := r.Context()
+
+	conditions, err := parseWriteConditions(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The conditions are checked on the primary store, an evicted object is
+	// brought back first
+	if err = h.files.RestoreEvicted(ctx, bucket, key); err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	// Fail before reading the body when the condition already does not hold
+	info, err := h.files.Stat(ctx, bucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		info, err = nil, nil
+	}
+	if err == nil {
+		conditions, err = evaluateWriteConditions(conditions, info)
+	}
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	exists := info != nil
+
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	versionId := ""
+	if bucketConfig.Versioning {
+		// The write is pinned to the content kept as the previous version, a
+		// concurrent change fails it rather than going missing from the versions
+		etag := ""
+		if exists {
+			versionId, etag, err = h.files.KeepVersion(ctx, bucket, key)
+			if err != nil {
+				writeStorageError(w, r, err)
+				return
+			}
+		}
+		switch {
+		case versionId == "" && conditions.IfMatch == "":
+			conditions.IfNoneMatch = "*"
+		case versionId != "" && conditions.IfMatch != "" && conditions.IfMatch != etag:
+			h.settleVersion(ctx, bucket, key, versionId, false)
+			writeStorageError(w, r, storage.ErrPreconditionFailed)
+			return
+		case versionId != "":
+			conditions.IfMatch = etag
+		}
+	}
+	h.receiveUpload(w, r, conditions, exists, versionId)
+}
+
+// parseWriteConditions reads the If-Match and If-None-Match headers of a
+// write. If-None-Match only supports "*" and the two cannot be combined.
+func parseWriteConditions(r *http.Request) (storage.Conditions, error) {
+	conditions := storage.Conditions{
+		IfMatch:     r.Header.Get("If-Match"),
+		IfNoneMatch: r.Header.Get("If-None-Match"),
+	}
+	if conditions.IfNoneMatch != "" && conditions.IfNoneMatch != "*" {
+		return conditions, errors.New("If-None-Match only supports *")
+	}
+	if conditions.IfMatch != "" && conditions.IfNoneMatch != "" {
+		return conditions, errors.New("If-Match and If-None-Match cannot be combined")
+	}
+	return conditions, nil
+}
+
+// evaluateWriteConditions checks the conditions of a write against the
+// current object, nil when there is none, so a write bound to fail is
+// rejected before its body is read. "If-Match: *" is pinned to the current
+// ETag so a concurrent replace is not overwritten. The store checks the
+// returned conditions again atomically.
+func evaluateWriteConditions(conditions storage.Conditions, current *storage.ObjectInfo) (storage.Conditions, error) {
+	switch {
+	case conditions.IfNoneMatch == "*" && current != nil, conditions.IfMatch != "" && current == nil:
+		return conditions, storage.ErrPreconditionFailed
+	case conditions.IfMatch == "*":
+		conditions.IfMatch = current.ETag
+	case conditions.IfMatch != "" && conditions.IfMatch != current.ETag:
+		return conditions, storage.ErrPreconditionFailed
+	}
+	return conditions, nil
+}
+
+// receiveUpload streams the "file" part of a multipart form into the store
+// without buffering the form. Form fields must be sent before the file part,
+// fields after it are ignored. replaced tells an existing object is overwritten,
+// versionId is the version kept of it, settled once the upload is done.
+func (h *Handler) receiveUpload(w http.ResponseWriter, r *http.Request, conditions storage.Conditions, replaced bool, versionId string) {
+	stored := false
+	defer func() {
+		h.settleVersion(r.Context(), chi.URLParam(r, "bucket"), chi.URLParam(r, "*"), versionId, stored)
+	}()
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "multipart form expected")
+		return
 	}
 
 	var metadata map[string]string
-	metadataStr := r.FormValue("metadata")
-	if metadataStr != "" {
-		err = json.Unmarshal([]byte(metadataStr), &metadata)
+	profile := ""
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			http.Error(w, "Invalid metadata JSON", http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, "Invalid multipart form")
+			return
+		}
+
+		switch part.FormName() {
+		case "metadata":
+			metadataStr, err := io.ReadAll(io.LimitReader(part, maxMetadataSize))
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "Invalid multipart form")
+				return
+			}
+			if err = json.Unmarshal(metadataStr, &metadata); err != nil {
+				writeError(w, r, http.StatusBadRequest, "Invalid metadata JSON")
+				return
+			}
+		case "profile":
+			profileName, err := io.ReadAll(io.LimitReader(part, maxMetadataSize))
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "Invalid multipart form")
+				return
+			}
+			profile = string(profileName)
+			if _, err = config.GetOptimizationProfile(profile); err != nil {
+				writeError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+		case "file":
+			stored = h.uploadFile(w, r, part, metadata, profile, conditions, replaced)
 			return
 		}
 	}
+	writeError(w, r, http.StatusBadRequest, "file field is required")
+}
+
+// uploadFile stores the file part and writes the response. It reports whether
+// the object was stored, even when a later step failed.
+func (h *Handler) uploadFile(w http.ResponseWriter, r *http.Request, part *multipart.Part, metadata map[string]string, profile string, conditions storage.Conditions, replaced bool) bool {
+	bucket := chi.URLParam(r, "bucket")
+	key := chi.URLParam(r, "*")
+	ctx := r.Context()
+	defer part.Close()
+
+	body := bufio.NewReaderSize(part, 512)
+	contentType := part.Header.Get("Content-Type")
+	isImageOrVideo := strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/")
+	if !isImageOrVideo {
+		head, _ := body.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+	if signed := signedURLFromContext(ctx); signed != nil && signed.ContentType != "" && signed.ContentType != contentType {
+		writeError(w, r, http.StatusForbidden, "Content type not allowed by signature")
+		return false
+	}
+	file := &countingReader{r: body}
+
+	bucketConfig, err := config.GetBucketConfig(bucket)
 	if err != nil {
-		http.Error(w, "file field is required", http.StatusBadRequest)
-		return
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if profile == "" {
+		profile = bucketConfig.Profile
+	}
+	optimizationProfile, err := config.GetOptimizationProfile(profile)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return false
 	}
-	defer file.Close()
 
+	// The size of a streamed part is unknown until it has been read
 	putOptions := &storage.PutOptions{
-		ContentType:   contentType,
-		Metadata:      metadata,
-		ContentLength: header.Size,
+		ContentType: contentType,
+		Metadata:    metadata,
+		Profile:     profile,
+	}
+	// The upload is stored as is, optimization runs in the worker so slow
+	// encodes do not hold the request
+	optimize := optimizationProfile.Optimizes(contentType)
+	storeOptions := *putOptions
+	storeOptions.Profile = config.DisabledProfile
+	storeOptions.Conditions = conditions
+	storeOptions.Metadata = maps.Clone(metadata)
+	if storeOptions.Metadata == nil {
+		storeOptions.Metadata = map[string]string{}
+	}
+	if optimize {
+		storeOptions.Metadata[storage.StateMetadata] = storage.StateProcessing
 	}
 
-	err = h.files.Upload(ctx, bucket, key, file, putOptions)
+	var upload io.Reader = file
+	isImageOrVideo = strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/")
+	if isImageOrVideo {
+		// Media is spooled to disk to read its technical metadata before it is stored
+		spooled, err := os.CreateTemp("", "upload-*")
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return false
+		}
+		defer os.Remove(spooled.Name())
+		defer spooled.Close()
+		if _, err = io.Copy(spooled, file); err == nil {
+			_, err = spooled.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			writeUploadError(w, r, err)
+			return false
+		}
+		extracted, err := processing.ExtractMetadata(ctx, spooled.Name(), contentType)
+		if err != nil {
+			slog.Warn("metadata extraction failed", "bucket", bucket, "key", key, "error", err)
+		}
+		maps.Copy(storeOptions.Metadata, extracted)
+		storeOptions.ContentLength = file.n
+		upload = spooled
+	}
+
+	replicas, err := h.files.UploadReplicated(ctx, bucket, key, upload, &storeOptions)
+	switch {
+	case errors.Is(err, storage.ErrPreconditionFailed) && r.Method == http.MethodPost:
+		// A concurrent upload stored the key first
+		err = storage.ErrAlreadyExists
+	case errors.Is(err, storage.ErrNotFound) && conditions.IfMatch != "":
+		// The object was deleted after the ETag was checked
+		err = storage.ErrPreconditionFailed
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		writeUploadError(w, r, err)
+		return false
+	}
+	if replaced {
+		// Thumbnails, variants and renditions of the previous content are generated again
+		h.invalidateDerived(ctx, bucket, key)
+		h.files.DeleteOriginal(ctx, bucket, key)
 	}
+	putOptions.Metadata = storeOptions.Metadata
+	putOptions.ContentLength = file.n
 
-	queue.EnqueueBackup(queue.BackupJob{
-		Key:    key,
-		Bucket: bucket,
-	})
+	res := uploadResponse{PutOptions: putOptions, Replicas: replicas}
+	res.Job, err = scheduleUpload(bucket, key, contentType, profile, optimize)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return true
+	}
+	writeJSON(w, http.StatusOK, res)
+	return true
+}
 
-	if strings.HasPrefix(contentType, "video/") {
-		queue.EnqueueGenerateThumb(queue.GenerateThumbJob{
-			Key:    key,
-			Bucket: bucket,
-		})
+// scheduleUpload hands a stored client upload to the worker: the optimization
+// when the profile optimizes its content type, which schedules the backup and
+// derived objects once done, or else directly the latter. It returns the
+// optimization job id.
+func scheduleUpload(bucket string, key string, contentType string, profile string, optimize bool) (string, error) {
+	if !optimize {
+		processing.ScheduleProcessing(bucket, key, contentType)
+		return "", nil
 	}
+	return queue.EnqueueOptimize(queue.OptimizeJob{
+		Key:     key,
+		Bucket:  bucket,
+		Profile: profile,
+	})
+}
 
-	res, err := json.Marshal(putOptions)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "File exceeds the signed size limit")
 		return
 	}
+	writeStorageError(w, r, err)
+}
 
-	w.Write(res)
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
-func writeCacheHeaders(w http.ResponseWriter, r *http.Request, file *storage.GetObject, tempCache bool) bool {
+// writeCacheHeaders writes the headers of a download and answers conditional
+// requests. Objects can be overwritten, so they are cached for maxAge at most
+// and revalidated with their ETag afterwards.
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, file *storage.GetObject, tempCache bool, private bool, maxAge time.Duration) bool {
 	w.Header().Set("Content-Type", file.ContentType)
 	if file.ContentLength > 0 {
 		w.Header().Set("Content-Length", strconv.FormatInt(file.ContentLength, 10))
 	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	if strings.HasPrefix(file.ContentType, "image/") {
+		w.Header().Set("Vary", "Accept")
+	}
 	w.Header().Set("ETag", file.ETag)
 	w.Header().Set("Last-Modified", file.LastModified.Format(http.TimeFormat))
-	if tempCache {
-		w.Header().Set("Cache-Control", "public, max-age=3600, stale-while-revalidate=86400, stale-if-error=1200")
+	for name, value := range file.Metadata {
+		w.Header().Set("X-Meta-"+name, value)
+	}
+	visibility := "public"
+	if private {
+		visibility = "private"
+	}
+	if file.Metadata[storage.StateMetadata] == storage.StateProcessing {
+		// The worker replaces the object with its optimized version shortly
+		w.Header().Set("Cache-Control", visibility+", no-cache")
+	} else if tempCache {
+		w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d, stale-while-revalidate=86400, stale-if-error=1200", visibility, int(min(maxAge, time.Hour).Seconds())))
+	} else if file.ContentType == processing.HLSPlaylistType {
+		// Playlists are rewritten when the video is transcoded again
+		w.Header().Set("Cache-Control", visibility+", max-age=60, stale-while-revalidate=600, stale-if-error=1200")
 	} else {
-		w.Header().Set("Cache-Control", "public, max-age=31536000, stale-if-error=1200, immutable")
+		w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d, stale-if-error=1200", visibility, int(maxAge.Seconds())))
 	}
 
-	if match := r.Header.Get("If-None-Match"); match == file.ETag {
-		w.WriteHeader(http.StatusNotModified)
-		return true
+	// If-Modified-Since is ignored when If-None-Match is sent, Last-Modified
+	// only has a precision of one second
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if match == file.ETag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
 	}
-
 	ifModifiedSince := r.Header.Get("If-Modified-Since")
 	if ifModifiedSince != "" {
 		t, err := http.ParseTime(ifModifiedSince)
-		if err == nil && file.LastModified.Before(t) {
+		if err == nil && !file.LastModified.Truncate(time.Second).After(t) {
 			w.WriteHeader(http.StatusNotModified)
 			return true
 		}
@@ -119,52 +428,322 @@ func writeCacheHeaders(w http.ResponseWriter, r *http.Request, file *storage.Get
 	return false
 }
 
+// fetch returns the object from the primary store, falling back to the
+// backups (or thumbnail generation) when it is missing. The returned bool is
+// true when the response should only be cached temporarily.
+func (h *Handler) fetch(ctx context.Context, bucket string, key string, opts *storage.GetOptions) (*storage.GetObject, bool, error) {
+	exists, err := h.files.Exists(ctx, bucket, key)
+	if exists {
+		out, err := h.files.GetFile(ctx, bucket, key, opts)
+		return out, false, err
+	}
+
+	payload := &queue.BackupJob{Key: key, Bucket: bucket}
+	if err == nil && strings.HasSuffix(key, processing.ThumbExt) {
+		out, err := processing.FetchAndGenerateThumb(ctx, h.files, payload, opts)
+		return out, false, err
+	}
+	// Backups are tried when the primary store fails as well, its error is
+	// only reported when they do not have the object either
+	out, backupErr := processing.FetchFromBackup(ctx, payload, opts)
+	if err != nil && errors.Is(backupErr, storage.ErrNotFound) {
+		return nil, true, err
+	}
+	return out, true, backupErr
+}
+
+// checkReadPolicy returns the status for a read of key under the bucket's
+// read policy, http.StatusOK when it is allowed.
+func checkReadPolicy(r *http.Request, bucketConfig *config.BucketConfig, bucket string, key string) int {
+	if isInternalBucket(bucket) {
+		return http.StatusForbidden
+	}
+	signed := signedURLFromContext(r.Context())
+	principal := principalFromContext(r.Context())
+	switch bucketConfig.Read {
+	case config.ReadAuthenticated:
+		if signed != nil || principal.Allows(auth.OpRead, bucket, key) {
+			return http.StatusOK
+		}
+	case config.ReadSigned:
+		if signed != nil {
+			return http.StatusOK
+		}
+	default:
+		return http.StatusOK
+	}
+	if principal == nil {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+// resolveKey returns the key served for a download of key, a generated
+// transform or the best variant the client accepts. On failure the error
+// response has been written and ok is false.
+func (h *Handler) resolveKey(w http.ResponseWriter, r *http.Request, bucketConfig *config.BucketConfig, bucket string, key string) (string, bool) {
+	ctx := r.Context()
+	transform, err := parseTransform(r.URL.Query(), bucketConfig)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	if transform != nil {
+		if formats := processing.AcceptedVariantFormats(r); transform.Format == "" && len(formats) > 0 {
+			transform.Format = formats[0]
+		}
+		key, err = processing.EnsureTransformed(ctx, h.files, bucket, key, transform)
+		if errors.Is(err, processing.ErrNotImage) {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return "", false
+		}
+		if err != nil {
+			writeStorageError(w, r, err)
+			return "", false
+		}
+	} else if !processing.IsHLSKey(key) && processing.MayHaveVariants(key) {
+		// Serve the smallest variant the client supports, falling back to the
+		// original. Variants are only served while the original exists, a variant
+		// left behind by a failed cleanup must not outlive a delete.
+		formats := processing.AcceptedVariantFormats(r)
+		if len(formats) > 0 {
+			if exists, _ := h.files.ExistsOrEvicted(ctx, bucket, key); !exists {
+				formats = nil
+			}
+		}
+		for _, format := range formats {
+			variantKey := processing.VariantKey(key, format)
+			if exists, _ := h.files.Exists(ctx, bucket, variantKey); exists {
+				key = variantKey
+				break
+			}
+		}
+	}
+	return key, true
+}
+
+// authorizeRead loads the bucket settings and checks the read policy. On
+// failure the error response has been written and the config is nil.
+func authorizeRead(w http.ResponseWriter, r *http.Request, bucket string, key string) *config.BucketConfig {
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	if status := checkReadPolicy(r, bucketConfig, bucket, key); status != http.StatusOK {
+		writeError(w, r, status, http.StatusText(status))
+		return nil
+	}
+	return bucketConfig
+}
+
+// stat returns the attributes of an object from the primary store, or from
+// the backups when it is missing. The returned bool is true when the response
+// should only be cached temporarily.
+func (h *Handler) stat(ctx context.Context, bucket string, key string) (*storage.ObjectInfo, bool, error) {
+	info, err := h.files.Stat(ctx, bucket, key)
+	if err == nil {
+		return info, false, nil
+	}
+	info, backupErr := processing.StatFromBackup(ctx, bucket, key)
+	if !errors.Is(err, storage.ErrNotFound) && errors.Is(backupErr, storage.ErrNotFound) {
+		return nil, true, err
+	}
+	return info, true, backupErr
+}
+
+// Head returns the headers of a download, read from the object's attributes
+// without opening its body.
+func (h *Handler) Head(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := chi.URLParam(r, "*")
+
+	bucketConfig := authorizeRead(w, r, bucket, key)
+	if bucketConfig == nil {
+		return
+	}
+	key, ok := h.resolveKey(w, r, bucketConfig, bucket, key)
+	if !ok {
+		return
+	}
+	info, tempCache, err := h.stat(r.Context(), bucket, key)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+
+	writeCacheHeaders(w, r, &storage.GetObject{
+		ContentType:   info.ContentType,
+		Metadata:      info.Metadata,
+		ContentLength: info.Size,
+		ETag:          info.ETag,
+		LastModified:  info.LastModified,
+		Size:          info.Size,
+	}, tempCache, bucketConfig.IsPrivate(), bucketConfig.GetCacheMaxAge())
+}
+
+// writeMeta writes the object's attributes and metadata as JSON.
+func (h *Handler) writeMeta(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	info, _, err := h.stat(r.Context(), bucket, key)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, info)
+}
+
 func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
 	bucket := chi.URLParam(r, "bucket")
 	key := chi.URLParam(r, "*")
 	ctx := r.Context()
 
-	exists := h.files.Exists(ctx, bucket, key)
-
-	if exists {
-		out, err := h.files.GetFile(ctx, bucket, key)
-		if err != nil {
-			http.NotFound(w, r)
+	bucketConfig := authorizeRead(w, r, bucket, key)
+	if bucketConfig == nil {
+		return
+	}
+	query := r.URL.Query()
+	if query.Has("meta") {
+		h.writeMeta(w, r, bucket, key)
+		return
+	}
+	if query.Has("versions") {
+		if authorizeVersions(w, r, bucket, key) {
+			h.writeVersions(w, r, bucket, key)
+		}
+		return
+	}
+	if versionId := query.Get("versionId"); versionId != "" {
+		if !authorizeVersions(w, r, bucket, key) {
 			return
 		}
-		defer out.Body.Close()
+		h.downloadVersion(w, r, bucketConfig, bucket, key, versionId)
+		return
+	}
+	key, ok := h.resolveKey(w, r, bucketConfig, bucket, key)
+	if !ok {
+		return
+	}
+	h.serve(w, r, bucketConfig, func(opts *storage.GetOptions) (*storage.GetObject, bool, error) {
+		out, tempCache, err := h.fetch(ctx, bucket, key, opts)
+		if err == nil && bucketConfig.PrimaryBudget > 0 {
+			// Eviction keeps the most recently downloaded objects in the primary store
+			if err := queue.RecordAccess(ctx, bucket, key); err != nil {
+				slog.Warn("recording access failed", "bucket", bucket, "key", key, "error", err)
+			}
+		}
+		return out, tempCache, err
+	})
+}
+
+// serve writes the object returned by fetch, answering Range requests from a
+// single read covering every range. fetch also reports whether the response
+// should only be cached temporarily.
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request, bucketConfig *config.BucketConfig, fetch func(*storage.GetOptions) (*storage.GetObject, bool, error)) {
+	ranges, err := parseRange(r.Header.Get("Range"))
+	if errors.Is(err, storage.ErrInvalidRange) {
+		writeError(w, r, http.StatusRequestedRangeNotSatisfiable, err.Error())
+		return
+	}
+	opts := &storage.GetOptions{}
+	if len(ranges) == 1 {
+		opts.Range = &ranges[0]
+	} else if len(ranges) > 1 {
+		opts.Range = coveringRange(ranges)
+	}
 
-		if ret := writeCacheHeaders(w, r, out, false); ret {
+	out, tempCache, err := fetch(opts)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	if len(ranges) > 0 && !ifRangeMatches(r, out) {
+		out.Body.Close()
+		ranges, opts.Range = nil, nil
+		out, tempCache, err = fetch(opts)
+		if err != nil {
+			writeStorageError(w, r, err)
 			return
 		}
+	}
+	defer out.Body.Close()
 
-		io.Copy(w, out.Body)
-	} else {
-		var out *storage.GetObject
-		var err error
-		payload := &queue.BackupJob{Key: key, Bucket: bucket}
-		isThumb := strings.HasSuffix(key, processing.ThumbExt)
+	if ret := writeCacheHeaders(w, r, out, tempCache, bucketConfig.IsPrivate(), bucketConfig.GetCacheMaxAge()); ret {
+		return
+	}
 
-		if isThumb {
-			out, err = processing.FetchAndGenerateThumb(ctx, h.files, payload)
-			if err != nil {
-				http.NotFound(w, r)
-				return
-			}
-		} else {
-			out, err = processing.FetchFromBackup(ctx, payload)
-			if err != nil {
-				http.NotFound(w, r)
-				return
-			}
-		}
-		defer out.Body.Close()
+	if len(ranges) > 0 {
+		writeRanges(w, out, ranges)
+		return
+	}
+	io.Copy(w, out.Body)
+}
 
-		if ret := writeCacheHeaders(w, r, out, !isThumb); ret {
-			return
+// parseListOptions reads the prefix, delimiter, limit, cursor and
+// contentType flag of a listing. On failure the error response has been written and opts is nil.
+func parseListOptions(w http.ResponseWriter, r *http.Request) *storage.ListOptions {
+	query := r.URL.Query()
+	opts := &storage.ListOptions{
+		Prefix:    query.Get("prefix"),
+		Delimiter: query.Get("delimiter"),
+		Limit:     defaultListLimit,
+	}
+	opts.ContentTypes, _ = strconv.ParseBool(query.Get("contentType"))
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxListLimit {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxListLimit))
+			return nil
 		}
+		opts.Limit = n
+	}
+	// The cursor is the backend continuation token, encoded so clients treat it as opaque
+	if cursor := query.Get("cursor"); cursor != "" {
+		token, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid cursor")
+			return nil
+		}
+		opts.Cursor = string(token)
+	}
+	return opts
+}
+
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	ctx := r.Context()
+
+	opts := parseListOptions(w, r)
+	if opts == nil {
+		return
+	}
+
+	result, err := h.files.List(ctx, bucket, opts)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	if result.Cursor != "" {
+		result.Cursor = base64.RawURLEncoding.EncodeToString([]byte(result.Cursor))
+	}
+
+	res, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-		io.Copy(w, out.Body)
+	w.Write(res)
+}
+
+// invalidateDerived deletes the objects derived from a deleted or replaced
+// object, and their backups in the background. Failures are only logged.
+func (h *Handler) invalidateDerived(ctx context.Context, bucket string, key string) {
+	if err := processing.InvalidateDerived(ctx, h.files, bucket, key); err != nil {
+		slog.Warn("derived objects invalidation failed", "bucket", bucket, "key", key, "error", err)
+	}
+	if err := queue.EnqueueInvalidateDerived(queue.InvalidateDerivedJob{Key: key, Bucket: bucket}); err != nil {
+		slog.Warn("enqueueing derived objects invalidation failed", "bucket", bucket, "key", key, "error", err)
 	}
 }
 
@@ -174,11 +753,64 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	deleteBackup := r.URL.Query().Get("deleteBackup")
 	ctx := r.Context()
 
-	err := h.files.Delete(ctx, bucket, key)
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// The delete is pinned to the content kept as the previous version
+	versionId, etag := "", ""
+	if bucketConfig.Versioning {
+		if versionId, etag, err = h.files.KeepVersion(ctx, bucket, key); err != nil {
+			writeStorageError(w, r, err)
+			return
+		}
+	}
+
+	if bucketConfig.SoftDelete {
+		// The kept original stays until the trash is purged, so an undeleted object keeps it
+		err = h.files.Trash(ctx, bucket, key, etag)
+		h.settleVersion(ctx, bucket, key, versionId, err == nil)
+		if errors.Is(err, storage.ErrNotFound) && deleteBackup == "true" {
+			err = nil
+		}
+		if err != nil {
+			writeStorageError(w, r, err)
+			return
+		}
+		// An undeleted object is processed again
+		h.invalidateDerived(ctx, bucket, key)
+		if bucketConfig.PrimaryBudget > 0 {
+			queue.ForgetAccess(ctx, bucket, key)
+		}
+		if deleteBackup == "true" {
+			queue.EnqueueTrash(queue.TrashJob{
+				Key:    key,
+				Bucket: bucket,
+			})
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if etag != "" {
+		err = h.files.DeleteIf(ctx, bucket, key, &storage.Conditions{IfMatch: etag})
+		if errors.Is(err, storage.ErrNotFound) {
+			err = storage.ErrPreconditionFailed
+		}
+	} else {
+		err = h.files.Delete(ctx, bucket, key)
+	}
+	h.settleVersion(ctx, bucket, key, versionId, err == nil)
 	if err != nil {
-		http.NotFound(w, r)
+		writeStorageError(w, r, err)
 		return
 	}
+	h.invalidateDerived(ctx, bucket, key)
+	h.files.DeleteOriginal(ctx, bucket, key)
+	if bucketConfig.PrimaryBudget > 0 {
+		queue.ForgetAccess(ctx, bucket, key)
+	}
 	if deleteBackup == "true" {
 		queue.EnqueueDelete(queue.DeleteJob{
 			Key:    key,
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/internal/auth"
+	"github.com/storage-gateway/src/queue"
+)
+
+type jobResponse struct {
+	ID          string     `json:"id"`
+	Type        string     `json:"type"`
+	State       string     `json:"state"`
+	Bucket      string     `json:"bucket"`
+	Key         string     `json:"key,omitempty"`
+	Retried     int        `json:"retried"`
+	LastError   string     `json:"lastError,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// Result is the JSON report written by tasks such as a lifecycle run
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// GetJob reports the state of a background task, such as the optimization
+// job returned by an upload.
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	info, err := queue.GetTask(chi.URLParam(r, "id"))
+	if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+		writeError(w, r, http.StatusNotFound, "job not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var payload struct {
+		Bucket string `json:"bucket"`
+		Key    string `json:"key"`
+	}
+	json.Unmarshal(info.Payload, &payload)
+	if !principalFromContext(r.Context()).Allows(auth.OpRead, payload.Bucket, payload.Key) {
+		writeError(w, r, http.StatusNotFound, "job not found")
+		return
+	}
+
+	res := jobResponse{
+		ID:        info.ID,
+		Type:      info.Type,
+		State:     info.State.String(),
+		Bucket:    payload.Bucket,
+		Key:       payload.Key,
+		Retried:   info.Retried,
+		LastError: info.LastErr,
+	}
+	if !info.CompletedAt.IsZero() {
+		res.CompletedAt = &info.CompletedAt
+	}
+	if json.Valid(info.Result) {
+		res.Result = info.Result
+	}
+	writeJSON(w, http.StatusOK, res)
+}
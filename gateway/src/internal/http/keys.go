@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/storage-gateway/src/internal/auth"
+)
+
+type apiKeyResponse struct {
+	*auth.APIKey
+	// Token is only returned when a key is created or rotated
+	Token string `json:"token,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	res, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(res)
+}
+
+func (h *Handler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var key auth.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if len(key.Operations) == 0 {
+		writeError(w, r, http.StatusBadRequest, "operations are required")
+		return
+	}
+
+	created, token, err := auth.GetKeyStore().Create(&key)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, apiKeyResponse{APIKey: created, Token: token})
+}
+
+func (h *Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := auth.GetKeyStore().List()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (h *Handler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	key, token, err := auth.GetKeyStore().Rotate(chi.URLParam(r, "id"))
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, apiKeyResponse{APIKey: key, Token: token})
+}
+
+func (h *Handler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	err := auth.GetKeyStore().Revoke(chi.URLParam(r, "id"))
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/queue"
+)
+
+// ApplyLifecycle runs the lifecycle rules of a bucket now, or of every bucket
+// when none is given. With dryRun the job's result only reports the objects
+// that would be expired.
+func (h *Handler) ApplyLifecycle(w http.ResponseWriter, r *http.Request) {
+	var job queue.LifecycleJob
+	// An empty body runs every bucket's rules, like {}
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if job.Bucket != "" {
+		if _, err := config.GetBucketConfig(job.Bucket); err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	id, err := queue.EnqueueLifecycle(job)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, struct {
+		queue.LifecycleJob
+		Job string `json:"job"`
+	}{job, id})
+}
@@ -0,0 +1,214 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/storage-gateway/src/internal/service"
+	"github.com/storage-gateway/src/storage"
+)
+
+// listStore lists sorted keys like S3 does: common prefixes count towards the
+// limit and the cursor is the last key or prefix returned.
+type listStore struct {
+	storage.Storage
+	keys []string
+	// last holds the options of the last List call
+	last storage.ListOptions
+}
+
+func (s *listStore) List(ctx context.Context, bucket string, opts *storage.ListOptions) (*storage.ListResult, error) {
+	s.last = *opts
+	result := &storage.ListResult{Objects: []storage.ObjectInfo{}, Prefixes: []string{}}
+	last := opts.Cursor
+	for _, key := range s.keys {
+		if key <= opts.Cursor || !strings.HasPrefix(key, opts.Prefix) {
+			continue
+		}
+		entry := key
+		if opts.Delimiter != "" {
+			if i := strings.Index(key[len(opts.Prefix):], opts.Delimiter); i >= 0 {
+				entry = key[:len(opts.Prefix)+i+len(opts.Delimiter)]
+			}
+		}
+		if entry <= last {
+			// Another key of the prefix returned last
+			continue
+		}
+		if len(result.Objects)+len(result.Prefixes) == opts.Limit {
+			result.Cursor = last
+			break
+		}
+		if entry == key {
+			result.Objects = append(result.Objects, storage.ObjectInfo{Key: key})
+		} else {
+			result.Prefixes = append(result.Prefixes, entry)
+			// Keys under the prefix sort before the next entry
+			entry += "\xff"
+		}
+		last = entry
+	}
+	return result, nil
+}
+
+func listRequest(t *testing.T, h *Handler, query url.Values) (*httptest.ResponseRecorder, *storage.ListResult) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/bucket?"+query.Encode(), nil)
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("bucket", "bucket")
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx))
+	w := httptest.NewRecorder()
+	h.List(w, r)
+	if w.Code != http.StatusOK {
+		return w, nil
+	}
+	result := &storage.ListResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+		t.Fatalf("decoding the listing: %v", err)
+	}
+	return w, result
+}
+
+func TestListOptionsValidation(t *testing.T) {
+	store := &listStore{}
+	h := NewHandler(service.NewFileService(store), nil)
+	tests := []struct {
+		name  string
+		query url.Values
+		want  int
+	}{
+		{name: "defaults", query: url.Values{}, want: http.StatusOK},
+		{name: "max limit", query: url.Values{"limit": {"1000"}}, want: http.StatusOK},
+		{name: "zero limit", query: url.Values{"limit": {"0"}}, want: http.StatusBadRequest},
+		{name: "negative limit", query: url.Values{"limit": {"-1"}}, want: http.StatusBadRequest},
+		{name: "limit too large", query: url.Values{"limit": {"1001"}}, want: http.StatusBadRequest},
+		{name: "limit not a number", query: url.Values{"limit": {"ten"}}, want: http.StatusBadRequest},
+		{name: "cursor not base64", query: url.Values{"cursor": {"not a cursor!"}}, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _ := listRequest(t, h, tt.query)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	listRequest(t, h, url.Values{"prefix": {"a/"}, "delimiter": {"/"}, "contentType": {"true"}})
+	want := storage.ListOptions{Prefix: "a/", Delimiter: "/", Limit: defaultListLimit, ContentTypes: true}
+	if store.last != want {
+		t.Errorf("store options = %+v, want %+v", store.last, want)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	store := &listStore{keys: []string{
+		"a.txt",
+		"photos/2023/a.jpg",
+		"photos/2023/b.jpg",
+		"photos/2024/c.jpg",
+		"photos/cover.jpg",
+		"photos/index.html",
+		"photos/videos/d.mp4",
+		"readme.md",
+	}}
+	h := NewHandler(service.NewFileService(store), nil)
+	tests := []struct {
+		name         string
+		prefix       string
+		delimiter    string
+		limit        string
+		wantObjects  []string
+		wantPrefixes []string
+		wantPages    int
+	}{
+		{
+			name:        "flat",
+			limit:       "3",
+			wantObjects: store.keys,
+			wantPages:   3,
+		},
+		{
+			name:         "root with delimiter",
+			delimiter:    "/",
+			limit:        "1",
+			wantObjects:  []string{"a.txt", "readme.md"},
+			wantPrefixes: []string{"photos/"},
+			wantPages:    3,
+		},
+		{
+			name:         "prefix with delimiter",
+			prefix:       "photos/",
+			delimiter:    "/",
+			limit:        "2",
+			wantObjects:  []string{"photos/cover.jpg", "photos/index.html"},
+			wantPrefixes: []string{"photos/2023/", "photos/2024/", "photos/videos/"},
+			wantPages:    3,
+		},
+		{
+			name:        "prefix without delimiter",
+			prefix:      "photos/2023/",
+			limit:       "100",
+			wantObjects: []string{"photos/2023/a.jpg", "photos/2023/b.jpg"},
+			wantPages:   1,
+		},
+		{
+			name:      "unknown prefix",
+			prefix:    "music/",
+			wantPages: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects, prefixes []string
+			query := url.Values{"prefix": {tt.prefix}, "delimiter": {tt.delimiter}}
+			if tt.limit != "" {
+				query.Set("limit", tt.limit)
+			}
+			pages := 0
+			for {
+				pages++
+				if pages > 10 {
+					t.Fatal("pagination does not end")
+				}
+				w, result := listRequest(t, h, query)
+				if result == nil {
+					t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+				}
+				for _, object := range result.Objects {
+					objects = append(objects, object.Key)
+				}
+				prefixes = append(prefixes, result.Prefixes...)
+				if result.Cursor == "" {
+					break
+				}
+				// The backend token is handed out encoded
+				if token, err := base64.RawURLEncoding.DecodeString(result.Cursor); err != nil || string(token) == result.Cursor {
+					t.Errorf("cursor %q is not the encoded backend token", result.Cursor)
+				}
+				query.Set("cursor", result.Cursor)
+			}
+			if pages != tt.wantPages {
+				t.Errorf("pages = %d, want %d", pages, tt.wantPages)
+			}
+			if !reflect.DeepEqual(objects, tt.wantObjects) {
+				t.Errorf("objects = %v, want %v", objects, tt.wantObjects)
+			}
+			if !reflect.DeepEqual(prefixes, tt.wantPrefixes) {
+				t.Errorf("prefixes = %v, want %v", prefixes, tt.wantPrefixes)
+			}
+			if !slices.IsSorted(objects) {
+				t.Errorf("objects are not sorted: %v", objects)
+			}
+		})
+	}
+}
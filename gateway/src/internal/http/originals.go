@@ -0,0 +1,66 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/queue"
+)
+
+// DownloadOriginal serves the untouched upload kept for an optimized object.
+func (h *Handler) DownloadOriginal(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := chi.URLParam(r, "*")
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	out, err := h.files.GetOriginal(r.Context(), bucket, key, nil)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	defer out.Body.Close()
+
+	if ret := writeCacheHeaders(w, r, out, false, true, bucketConfig.GetCacheMaxAge()); ret {
+		return
+	}
+	io.Copy(w, out.Body)
+}
+
+// Reoptimize schedules optimization to be re-run from the kept originals, for
+// example after a profile changed.
+func (h *Handler) Reoptimize(w http.ResponseWriter, r *http.Request) {
+	var job queue.ReoptimizeJob
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if job.Bucket == "" {
+		writeError(w, r, http.StatusBadRequest, "bucket is required")
+		return
+	}
+	if job.Profile != "" {
+		_, err := config.GetOptimizationProfile(job.Profile)
+		if errors.Is(err, config.ErrUnknownProfile) {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := queue.EnqueueReoptimize(job); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
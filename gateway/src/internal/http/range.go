@@ -0,0 +1,193 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/storage-gateway/src/storage"
+)
+
+var errInvalidRangeHeader = errors.New("invalid range header")
+
+// maxRanges bounds the parts of a multi-range request. Headers with more
+// parts, or with overlapping or unordered ones, are ignored and the whole
+// object is served, like net/http does for such requests.
+const maxRanges = 16
+
+// parseRange parses a "bytes=" Range header into storage ranges. Suffix and
+// open ended ranges are kept relative, they are resolved by the backend once
+// the object size is known.
+func parseRange(header string) ([]storage.Range, error) {
+	if header == "" {
+		return nil, nil
+	}
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, errInvalidRangeHeader
+	}
+
+	ranges := []storage.Range{}
+	// end of the previous absolute range, -1 once it is open ended
+	var end int64
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		startStr, endStr, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, errInvalidRangeHeader
+		}
+		startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+		if startStr == "" {
+			suffix, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, errInvalidRangeHeader
+			}
+			if suffix == 0 {
+				continue
+			}
+			ranges = append(ranges, storage.Range{Offset: -suffix, Length: -1})
+			continue
+		}
+
+		start, err := strconv.ParseInt(startStr, 10, 64)
+		if err != nil || start < 0 || end < 0 || start < end {
+			return nil, errInvalidRangeHeader
+		}
+		if endStr == "" {
+			ranges = append(ranges, storage.Range{Offset: start, Length: -1})
+			end = -1
+			continue
+		}
+		last, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || last < start {
+			return nil, errInvalidRangeHeader
+		}
+		ranges = append(ranges, storage.Range{Offset: start, Length: last - start + 1})
+		end = last + 1
+	}
+	if len(ranges) > maxRanges {
+		return nil, errInvalidRangeHeader
+	}
+	if len(ranges) == 0 {
+		return nil, storage.ErrInvalidRange
+	}
+	return ranges, nil
+}
+
+// coveringRange returns the span read for a multi-range request, from the
+// first to the last byte requested. Suffix ranges need the object size, the
+// whole object is read for them.
+func coveringRange(ranges []storage.Range) *storage.Range {
+	span := storage.Range{Offset: ranges[0].Offset}
+	for _, rng := range ranges {
+		if rng.Offset < 0 {
+			return nil
+		}
+		if rng.Length < 0 {
+			span.Length = -1
+		} else if span.Length >= 0 {
+			span.Length = max(span.Length, rng.Offset+rng.Length-span.Offset)
+		}
+	}
+	return &span
+}
+
+// resolveRange converts a relative range into an absolute one for an object
+// of the given size, ok is false when the range is not satisfiable.
+func resolveRange(r storage.Range, size int64) (storage.Range, bool) {
+	if r.Offset < 0 {
+		start := max(size+r.Offset, 0)
+		return storage.Range{Offset: start, Length: size - start}, size > 0
+	}
+	if r.Offset >= size {
+		return r, false
+	}
+	if r.Length < 0 || r.Offset+r.Length > size {
+		r.Length = size - r.Offset
+	}
+	return r, true
+}
+
+// ifRangeMatches reports whether the If-Range precondition allows a partial
+// response for the given object.
+func ifRangeMatches(r *http.Request, file *storage.GetObject) bool {
+	ifRange := r.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return !strings.HasPrefix(ifRange, "W/") && ifRange == file.ETag
+	}
+	t, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	return file.LastModified.Truncate(1e9).Equal(t)
+}
+
+func contentRange(offset int64, length int64, size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size)
+}
+
+// writeRanges writes a 206 response for the requested ranges. A multi-range
+// response is sliced from file, which covers every range (see coveringRange),
+// so the backend is read once whatever the number of parts. When the ranges
+// overlap once resolved, the whole object is served instead.
+func writeRanges(w http.ResponseWriter, file *storage.GetObject, ranges []storage.Range) {
+	if len(ranges) == 1 {
+		w.Header().Set("Content-Range", contentRange(file.Offset, file.ContentLength, file.Size))
+		w.WriteHeader(http.StatusPartialContent)
+		io.Copy(w, file.Body)
+		return
+	}
+
+	resolved := []storage.Range{}
+	position := file.Offset
+	for _, rng := range ranges {
+		rng, ok := resolveRange(rng, file.Size)
+		if !ok {
+			continue
+		}
+		if rng.Offset < position || rng.Offset+rng.Length > file.Offset+file.ContentLength {
+			// Only suffix ranges get here, the whole object was read for them
+			w.WriteHeader(http.StatusOK)
+			io.Copy(w, file.Body)
+			return
+		}
+		resolved = append(resolved, rng)
+		position = rng.Offset + rng.Length
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+
+	position = file.Offset
+	for _, rng := range resolved {
+		if _, err := io.CopyN(io.Discard, file.Body, rng.Offset-position); err != nil {
+			return
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {file.ContentType},
+			"Content-Range": {contentRange(rng.Offset, rng.Length, file.Size)},
+		})
+		if err != nil {
+			return
+		}
+		if _, err = io.CopyN(part, file.Body, rng.Length); err != nil {
+			return
+		}
+		position = rng.Offset + rng.Length
+	}
+	mw.Close()
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/storage-gateway/src/storage"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []storage.Range
+		err    error
+	}{
+		{header: "", want: nil},
+		{header: "bytes=0-99", want: []storage.Range{{Offset: 0, Length: 100}}},
+		{header: "bytes=100-", want: []storage.Range{{Offset: 100, Length: -1}}},
+		{header: "bytes=-500", want: []storage.Range{{Offset: -500, Length: -1}}},
+		{header: "bytes= 0 - 9 , 20-29", want: []storage.Range{{Offset: 0, Length: 10}, {Offset: 20, Length: 10}}},
+		{header: "bytes=0-9,,20-", want: []storage.Range{{Offset: 0, Length: 10}, {Offset: 20, Length: -1}}},
+		{header: "bytes=0-9,-5", want: []storage.Range{{Offset: 0, Length: 10}, {Offset: -5, Length: -1}}},
+		{header: "bytes=-0,0-0", want: []storage.Range{{Offset: 0, Length: 1}}},
+		{header: "bytes=-0", err: storage.ErrInvalidRange},
+		{header: "bytes=", err: storage.ErrInvalidRange},
+		{header: "items=0-9", err: errInvalidRangeHeader},
+		{header: "bytes=9-0", err: errInvalidRangeHeader},
+		{header: "bytes=a-9", err: errInvalidRangeHeader},
+		{header: "bytes=0-b", err: errInvalidRangeHeader},
+		{header: "bytes=5", err: errInvalidRangeHeader},
+		{header: "bytes=--5", err: errInvalidRangeHeader},
+		// Overlapping, unordered or following an open ended range
+		{header: "bytes=0-9,5-14", err: errInvalidRangeHeader},
+		{header: "bytes=20-29,0-9", err: errInvalidRangeHeader},
+		{header: "bytes=0-,10-19", err: errInvalidRangeHeader},
+		{header: "bytes=0-9,10-19", want: []storage.Range{{Offset: 0, Length: 10}, {Offset: 10, Length: 10}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, err := parseRange(tt.header)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("parseRange(%q) error = %v, want %v", tt.header, err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRange(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRangeCapsParts(t *testing.T) {
+	parts := make([]string, 0, maxRanges+1)
+	for i := range maxRanges + 1 {
+		parts = append(parts, fmt.Sprintf("%d-%d", i*10, i*10+4))
+	}
+	header := "bytes=" + strings.Join(parts, ",")
+
+	if _, err := parseRange(header); !errors.Is(err, errInvalidRangeHeader) {
+		t.Errorf("%d ranges: error = %v, want %v", maxRanges+1, err, errInvalidRangeHeader)
+	}
+	header = "bytes=" + strings.Join(parts[:maxRanges], ",")
+	if got, err := parseRange(header); err != nil || len(got) != maxRanges {
+		t.Errorf("%d ranges: got %d ranges, error = %v", maxRanges, len(got), err)
+	}
+}
+
+func TestCoveringRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []storage.Range
+		want   *storage.Range
+	}{
+		{
+			name:   "single",
+			ranges: []storage.Range{{Offset: 10, Length: 5}},
+			want:   &storage.Range{Offset: 10, Length: 5},
+		},
+		{
+			name:   "first to last byte",
+			ranges: []storage.Range{{Offset: 10, Length: 5}, {Offset: 100, Length: 20}},
+			want:   &storage.Range{Offset: 10, Length: 110},
+		},
+		{
+			name:   "open ended",
+			ranges: []storage.Range{{Offset: 10, Length: 5}, {Offset: 100, Length: -1}},
+			want:   &storage.Range{Offset: 10, Length: -1},
+		},
+		{
+			name:   "suffix",
+			ranges: []storage.Range{{Offset: 10, Length: 5}, {Offset: -5, Length: -1}},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := coveringRange(tt.ranges)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coveringRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		r      storage.Range
+		size   int64
+		want   storage.Range
+		wantOk bool
+	}{
+		{name: "inside", r: storage.Range{Offset: 10, Length: 10}, size: 100, want: storage.Range{Offset: 10, Length: 10}, wantOk: true},
+		{name: "past the end", r: storage.Range{Offset: 90, Length: 20}, size: 100, want: storage.Range{Offset: 90, Length: 10}, wantOk: true},
+		{name: "open ended", r: storage.Range{Offset: 40, Length: -1}, size: 100, want: storage.Range{Offset: 40, Length: 60}, wantOk: true},
+		{name: "suffix", r: storage.Range{Offset: -30, Length: -1}, size: 100, want: storage.Range{Offset: 70, Length: 30}, wantOk: true},
+		{name: "suffix longer than object", r: storage.Range{Offset: -300, Length: -1}, size: 100, want: storage.Range{Offset: 0, Length: 100}, wantOk: true},
+		{name: "suffix of empty object", r: storage.Range{Offset: -30, Length: -1}, size: 0, want: storage.Range{Offset: 0, Length: 0}, wantOk: false},
+		{name: "start at size", r: storage.Range{Offset: 100, Length: 1}, size: 100, want: storage.Range{Offset: 100, Length: 1}, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := resolveRange(tt.r, tt.size)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("resolveRange(%v, %d) = %v, %v, want %v, %v", tt.r, tt.size, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	file := &storage.GetObject{ETag: `"abc"`, LastModified: modified}
+	tests := []struct {
+		ifRange string
+		want    bool
+	}{
+		{ifRange: "", want: true},
+		{ifRange: `"abc"`, want: true},
+		{ifRange: `"def"`, want: false},
+		{ifRange: `W/"abc"`, want: false},
+		{ifRange: modified.Format(http.TimeFormat), want: true},
+		{ifRange: modified.Add(time.Second).Format(http.TimeFormat), want: false},
+		{ifRange: "yesterday", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ifRange, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/bucket/key", nil)
+			if tt.ifRange != "" {
+				r.Header.Set("If-Range", tt.ifRange)
+			}
+			if got := ifRangeMatches(r, file); got != tt.want {
+				t.Errorf("ifRangeMatches(%q) = %v, want %v", tt.ifRange, got, tt.want)
+			}
+		})
+	}
+}
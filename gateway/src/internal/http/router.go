@@ -8,6 +8,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
 	"github.com/go-chi/render"
+	"github.com/storage-gateway/src/internal/auth"
 )
 
 func NewRouter(h *Handler) *chi.Mux {
@@ -23,9 +24,44 @@ func NewRouter(h *Handler) *chi.Mux {
 	r.Use(cors.AllowAll().Handler)
 	r.Use(middleware.Heartbeat("/health"))
 
-	r.Get("/{bucket}/*", h.Download)
-	r.With(AuthMiddleware).Post("/{bucket}/*", h.Upload)
-	r.With(AuthMiddleware).Delete("/{bucket}/*", h.Delete)
+	r.Route("/_uploads/{bucket}", func(r chi.Router) {
+		r.Use(TusMiddleware)
+		r.Options("/", h.TusOptions)
+		r.Options("/{id}", h.TusOptions)
+		r.Group(func(r chi.Router) {
+			r.Use(AuthMiddleware, RequireOperation(auth.OpWrite))
+			r.Post("/", h.TusCreate)
+			r.Head("/{id}", h.TusHead)
+			r.Patch("/{id}", h.TusPatch)
+			r.Delete("/{id}", h.TusDelete)
+		})
+	})
+
+	r.Route("/_admin", func(r chi.Router) {
+		r.Use(AuthMiddleware, RequireOperation(auth.OpAdmin))
+		r.Post("/keys", h.CreateKey)
+		r.Get("/keys", h.ListKeys)
+		r.Post("/keys/{id}/rotate", h.RotateKey)
+		r.Delete("/keys/{id}", h.RevokeKey)
+		r.Post("/reoptimize", h.Reoptimize)
+		r.Post("/lifecycle", h.ApplyLifecycle)
+		r.Get("/backends", h.BackendHealth)
+	})
+
+	r.With(AuthMiddleware, RequireOperation(auth.OpRead)).Get("/_originals/{bucket}/*", h.DownloadOriginal)
+	r.With(AuthMiddleware, RequireOperation(auth.OpWrite)).Post("/_restore/{bucket}/*", h.RestoreVersion)
+	r.With(AuthMiddleware, RequireListing(auth.OpRead)).Get("/_trash/{bucket}", h.ListTrash)
+	r.With(AuthMiddleware, RequireOperation(auth.OpWrite)).Post("/_trash/{bucket}/*", h.Undelete)
+
+	r.With(AuthMiddleware).Post("/_presign", h.Presign)
+	r.With(AuthMiddleware).Get("/_jobs/{id}", h.GetJob)
+
+	r.With(AuthMiddleware, RequireListing(auth.OpRead)).Get("/{bucket}", h.List)
+	r.With(SignedURLMiddleware, OptionalAuthMiddleware).Get("/{bucket}/*", h.Download)
+	r.With(SignedURLMiddleware, OptionalAuthMiddleware).Head("/{bucket}/*", h.Head)
+	r.With(SignedOrAuthMiddleware, RequireOperation(auth.OpWrite)).Post("/{bucket}/*", h.Upload)
+	r.With(SignedOrAuthMiddleware, RequireOperation(auth.OpWrite)).Put("/{bucket}/*", h.Replace)
+	r.With(AuthMiddleware, RequireOperation(auth.OpDelete)).Delete("/{bucket}/*", h.Delete)
 
 	return r
 }
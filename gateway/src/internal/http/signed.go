@@ -0,0 +1,236 @@
+package http
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/internal/auth"
+)
+
+const (
+	defaultSignedURLExpiry = 15 * time.Minute
+	maxSignedURLExpiry     = 7 * 24 * time.Hour
+)
+
+// SignedURL is a capability for a single method on a single object. The
+// optional ContentType and MaxSize constrain what may be uploaded with it.
+type SignedURL struct {
+	Method      string `json:"method"`
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key"`
+	Expires     int64  `json:"expires"`
+	ContentType string `json:"contentType,omitempty"`
+	MaxSize     int64  `json:"maxSize,omitempty"`
+}
+
+type presignRequest struct {
+	Method      string `json:"method"`
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key"`
+	ExpiresIn   int64  `json:"expiresIn"`
+	ContentType string `json:"contentType"`
+	MaxSize     int64  `json:"maxSize"`
+}
+
+type presignResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+var errSigningDisabled = errors.New("Presigned URLs are disabled, URL_SIGNING_KEY is not set")
+
+// signingKey is empty when URL_SIGNING_KEY is not set, URLs are then neither
+// signed nor accepted.
+func signingKey() []byte {
+	return []byte(config.GetSafeEnv(config.UrlSigningKey))
+}
+
+func (s *SignedURL) signature() string {
+	mac := hmac.New(sha256.New, signingKey())
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%s\n%d", s.Method, s.Bucket, s.Key, s.Expires, s.ContentType, s.MaxSize)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *SignedURL) Query() url.Values {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(s.Expires, 10))
+	if s.ContentType != "" {
+		query.Set("content-type", s.ContentType)
+	}
+	if s.MaxSize > 0 {
+		query.Set("max-size", strconv.FormatInt(s.MaxSize, 10))
+	}
+	query.Set("signature", s.signature())
+	return query
+}
+
+// verifySignedURL checks the signature of a request made with a presigned URL.
+// It returns nil without error when the request carries no signature.
+func verifySignedURL(r *http.Request, bucket string, key string) (*SignedURL, error) {
+	query := r.URL.Query()
+	signature := query.Get("signature")
+	if signature == "" {
+		return nil, nil
+	}
+	if len(signingKey()) == 0 {
+		return nil, errSigningDisabled
+	}
+	if isInternalBucket(bucket) {
+		return nil, fmt.Errorf("Invalid signature")
+	}
+
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	signed := &SignedURL{
+		Method:      method,
+		Bucket:      bucket,
+		Key:         key,
+		ContentType: query.Get("content-type"),
+	}
+	var err error
+	if signed.Expires, err = strconv.ParseInt(query.Get("expires"), 10, 64); err != nil {
+		return nil, fmt.Errorf("Invalid signature")
+	}
+	if maxSize := query.Get("max-size"); maxSize != "" {
+		if signed.MaxSize, err = strconv.ParseInt(maxSize, 10, 64); err != nil || signed.MaxSize < 0 {
+			return nil, fmt.Errorf("Invalid signature")
+		}
+	}
+	if !hmac.Equal([]byte(signature), []byte(signed.signature())) {
+		return nil, fmt.Errorf("Invalid signature")
+	}
+	if time.Now().Unix() > signed.Expires {
+		return nil, fmt.Errorf("Signature expired")
+	}
+	return signed, nil
+}
+
+func signedURLFromContext(ctx context.Context) *SignedURL {
+	signed, _ := ctx.Value("signedUrl").(*SignedURL)
+	return signed
+}
+
+// SignedURLMiddleware verifies presigned URLs. Requests without a signature
+// pass through untouched, valid ones carry the SignedURL in their context.
+func SignedURLMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signed, err := verifySignedURL(r, chi.URLParam(r, "bucket"), chi.URLParam(r, "*"))
+		if err != nil {
+			writeError(w, r, http.StatusForbidden, err.Error())
+			return
+		}
+		if signed == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if signed.MaxSize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, signed.MaxSize)
+		}
+		ctx := context.WithValue(r.Context(), "signedUrl", signed)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SignedOrAuthMiddleware accepts either a valid presigned URL or the access
+// token checked by AuthMiddleware.
+func SignedOrAuthMiddleware(next http.Handler) http.Handler {
+	auth := AuthMiddleware(next)
+	return SignedURLMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signedURLFromContext(r.Context()) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth.ServeHTTP(w, r)
+	}))
+}
+
+func (h *Handler) Presign(w http.ResponseWriter, r *http.Request) {
+	if len(signingKey()) == 0 {
+		writeError(w, r, http.StatusServiceUnavailable, errSigningDisabled.Error())
+		return
+	}
+	var req presignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	req.Method = strings.ToUpper(req.Method)
+	if req.Method != http.MethodGet && req.Method != http.MethodPost && req.Method != http.MethodPut {
+		writeError(w, r, http.StatusBadRequest, "method must be GET, POST or PUT")
+		return
+	}
+	if req.Bucket == "" || req.Key == "" {
+		writeError(w, r, http.StatusBadRequest, "bucket and key are required")
+		return
+	}
+	if isInternalBucket(req.Bucket) {
+		writeError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+	op := auth.OpRead
+	if req.Method != http.MethodGet {
+		op = auth.OpWrite
+	}
+	if !principalFromContext(r.Context()).Allows(op, req.Bucket, req.Key) {
+		writeError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+	expiresIn := defaultSignedURLExpiry
+	if req.ExpiresIn > 0 {
+		expiresIn = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if expiresIn > maxSignedURLExpiry {
+		writeError(w, r, http.StatusBadRequest, "expiresIn exceeds 7 days")
+		return
+	}
+	if req.MaxSize < 0 {
+		writeError(w, r, http.StatusBadRequest, "maxSize must not be negative")
+		return
+	}
+
+	expiresAt := time.Now().Add(expiresIn)
+	signed := &SignedURL{
+		Method:      req.Method,
+		Bucket:      req.Bucket,
+		Key:         req.Key,
+		Expires:     expiresAt.Unix(),
+		ContentType: req.ContentType,
+		MaxSize:     req.MaxSize,
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     "/" + req.Bucket + "/" + req.Key,
+		RawQuery: signed.Query().Encode(),
+	}
+
+	res, err := json.Marshal(presignResponse{URL: u.String(), ExpiresAt: expiresAt.UTC()})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Write(res)
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/optimizer"
+)
+
+// parseTransform reads the image transformation parameters of a download.
+// It returns nil when the request has none.
+func parseTransform(query url.Values, bucketConfig *config.BucketConfig) (*optimizer.TransformOptions, error) {
+	if !query.Has("w") && !query.Has("h") && !query.Has("fit") && !query.Has("fmt") && !query.Has("q") {
+		return nil, nil
+	}
+	if bucketConfig.Transforms == nil {
+		return nil, errors.New("image transformations are not enabled for this bucket")
+	}
+
+	opts := &optimizer.TransformOptions{
+		Fit:     "contain",
+		Format:  query.Get("fmt"),
+		Quality: optimizer.DefaultQuality,
+	}
+	var err error
+	if w := query.Get("w"); w != "" {
+		if opts.Width, err = strconv.Atoi(w); err != nil || opts.Width < 0 {
+			return nil, errors.New("invalid width")
+		}
+	}
+	if h := query.Get("h"); h != "" {
+		if opts.Height, err = strconv.Atoi(h); err != nil || opts.Height < 0 {
+			return nil, errors.New("invalid height")
+		}
+	}
+	if opts.Width == 0 && opts.Height == 0 {
+		return nil, errors.New("w or h is required")
+	}
+	if fit := query.Get("fit"); fit != "" {
+		if !optimizer.ValidFit(fit) {
+			return nil, errors.New("fit must be cover or contain")
+		}
+		opts.Fit = fit
+	}
+	if opts.Format != "" && !optimizer.ValidFormat(opts.Format) {
+		return nil, errors.New("fmt must be one of webp, avif, jpeg or png")
+	}
+	if q := query.Get("q"); q != "" {
+		if opts.Quality, err = strconv.Atoi(q); err != nil {
+			return nil, errors.New("invalid quality")
+		}
+		if opts.Quality != optimizer.DefaultQuality && !slices.Contains(bucketConfig.Transforms.Qualities, opts.Quality) {
+			return nil, fmt.Errorf("quality %d is not allowed", opts.Quality)
+		}
+	}
+
+	size := fmt.Sprintf("%dx%d", opts.Width, opts.Height)
+	if !slices.Contains(bucketConfig.Transforms.Sizes, size) {
+		return nil, fmt.Errorf("size %s is not allowed", size)
+	}
+	return opts, nil
+}
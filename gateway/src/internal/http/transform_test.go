@@ -0,0 +1,63 @@
+package http
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/optimizer"
+)
+
+func TestParseTransform(t *testing.T) {
+	bucketConfig := &config.BucketConfig{Transforms: &config.TransformConfig{
+		Sizes:     []string{"320x240", "640x0", "0x100"},
+		Qualities: []int{50, 90},
+	}}
+	tests := []struct {
+		name    string
+		query   string
+		want    *optimizer.TransformOptions
+		wantErr bool
+	}{
+		{name: "no transform", query: "download=1", want: nil},
+		{name: "defaults", query: "w=320&h=240", want: &optimizer.TransformOptions{Width: 320, Height: 240, Fit: "contain", Quality: optimizer.DefaultQuality}},
+		{name: "width only", query: "w=640", want: &optimizer.TransformOptions{Width: 640, Fit: "contain", Quality: optimizer.DefaultQuality}},
+		{name: "height only", query: "h=100&fmt=webp", want: &optimizer.TransformOptions{Height: 100, Fit: "contain", Format: "webp", Quality: optimizer.DefaultQuality}},
+		{name: "all options", query: "w=320&h=240&fit=cover&fmt=avif&q=50", want: &optimizer.TransformOptions{Width: 320, Height: 240, Fit: "cover", Format: "avif", Quality: 50}},
+		{name: "default quality always allowed", query: "w=320&h=240&q=75", want: &optimizer.TransformOptions{Width: 320, Height: 240, Fit: "contain", Quality: optimizer.DefaultQuality}},
+		{name: "size not allowed", query: "w=321&h=240", wantErr: true},
+		{name: "no size", query: "fmt=webp", wantErr: true},
+		{name: "negative width", query: "w=-320&h=240", wantErr: true},
+		{name: "invalid height", query: "w=320&h=tall", wantErr: true},
+		{name: "invalid fit", query: "w=320&h=240&fit=fill", wantErr: true},
+		{name: "invalid format", query: "w=320&h=240&fmt=gif", wantErr: true},
+		{name: "quality not allowed", query: "w=320&h=240&q=100", wantErr: true},
+		{name: "invalid quality", query: "w=320&h=240&q=high", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseTransform(query, bucketConfig)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTransform(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTransform(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTransformDisabled(t *testing.T) {
+	query := url.Values{"w": {"320"}, "h": {"240"}}
+	if _, err := parseTransform(query, &config.BucketConfig{}); err == nil {
+		t.Error("parseTransform() accepted a transform for a bucket without transforms")
+	}
+	if got, err := parseTransform(url.Values{}, &config.BucketConfig{}); got != nil || err != nil {
+		t.Errorf("parseTransform() = %+v, %v without transform parameters", got, err)
+	}
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/processing"
+)
+
+// ListTrash lists the deleted objects of a soft delete bucket with the time
+// they are purged.
+func (h *Handler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	opts := parseListOptions(w, r)
+	if opts == nil {
+		return
+	}
+
+	result, err := h.files.ListTrash(r.Context(), bucket, opts, bucketConfig.GetTrashRetention())
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	if result.Cursor != "" {
+		result.Cursor = base64.RawURLEncoding.EncodeToString([]byte(result.Cursor))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Undelete moves an object back from the trash. It fails with 409 when the key
+// was reused since the object was deleted.
+func (h *Handler) Undelete(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := chi.URLParam(r, "*")
+
+	contentType, err := h.files.Undelete(r.Context(), bucket, key)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	// Backups moved to the trash are backed up again, their trash copy is purged with the others
+	processing.ScheduleProcessing(bucket, key, contentType)
+	w.WriteHeader(http.StatusNoContent)
+}
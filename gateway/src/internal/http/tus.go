@@ -0,0 +1,302 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/internal/auth"
+	"github.com/storage-gateway/src/internal/service"
+	"github.com/storage-gateway/src/processing"
+	"github.com/storage-gateway/src/storage"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,expiration"
+	// tusMaxSize is the S3 object size limit
+	tusMaxSize           = 5 * 1024 * 1024 * 1024 * 1024
+	tusOffsetOctetStream = "application/offset+octet-stream"
+)
+
+// TusMiddleware sets the protocol headers shared by every tus response and
+// rejects requests for an unsupported protocol version.
+func TusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			writeError(w, r, http.StatusPreconditionFailed, "Unsupported tus version")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseTusMetadata decodes an Upload-Metadata header, a comma separated list
+// of keys each followed by an optional base64 encoded value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for pair := range strings.SplitSeq(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, " ")
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata, nil
+}
+
+func writeTusUploadHeaders(w http.ResponseWriter, upload *service.TusUpload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if !upload.Completed() {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+func writeTusError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrUploadNotFound):
+		writeError(w, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrUploadExpired):
+		writeError(w, r, http.StatusGone, err.Error())
+	case errors.Is(err, service.ErrOffsetMismatch):
+		writeError(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrUploadLocked):
+		writeError(w, r, http.StatusLocked, err.Error())
+	case errors.Is(err, service.ErrUploadTooLarge):
+		writeError(w, r, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, service.ErrKeyAlreadyExists):
+		writeError(w, r, http.StatusBadRequest, err.Error())
+	default:
+		writeStorageError(w, r, err)
+	}
+}
+
+// completeTusUpload runs the steps that follow a POST upload on a completed
+// resumable upload: the technical metadata of images and videos is stored on
+// the object, it is replicated, which rolls it back when the quorum is not
+// reached, and handed to the worker.
+func (h *Handler) completeTusUpload(ctx context.Context, bucket string, upload *service.TusUpload) error {
+	if strings.HasPrefix(upload.ContentType, "image/") || strings.HasPrefix(upload.ContentType, "video/") {
+		if err := h.storeExtractedMetadata(ctx, bucket, upload.Key); err != nil {
+			slog.Warn("metadata extraction failed", "bucket", bucket, "key", upload.Key, "error", err)
+		}
+	}
+	if _, err := h.files.Replicate(ctx, bucket, upload.Key); err != nil {
+		return err
+	}
+	_, err := scheduleUpload(bucket, upload.Key, upload.ContentType, upload.Profile, upload.Optimize)
+	return err
+}
+
+// storeExtractedMetadata spools an object assembled in the primary store,
+// extracts its technical metadata and writes it back with the metadata, unless
+// it was replaced meanwhile.
+func (h *Handler) storeExtractedMetadata(ctx context.Context, bucket string, key string) error {
+	object, err := h.files.GetFile(ctx, bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	defer object.Body.Close()
+	spooled, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spooled.Name())
+	defer spooled.Close()
+	size, err := io.Copy(spooled, object.Body)
+	if err == nil {
+		_, err = spooled.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return err
+	}
+	extracted, err := processing.ExtractMetadata(ctx, spooled.Name(), object.ContentType)
+	if err != nil || len(extracted) == 0 {
+		return err
+	}
+	metadata := maps.Clone(object.Metadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	maps.Copy(metadata, extracted)
+	err = h.files.Upload(ctx, bucket, key, spooled, &storage.PutOptions{
+		ContentType:   object.ContentType,
+		Metadata:      metadata,
+		ContentLength: size,
+		Profile:       config.DisabledProfile,
+		Conditions:    storage.Conditions{IfMatch: object.ETag},
+	})
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		return nil
+	}
+	return err
+}
+
+func (h *Handler) TusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(tusMaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusCreate starts a resumable upload. The object key is taken from the
+// "key" (or "filename") metadata entry, "filetype" sets the content type and
+// "metadata" holds the same JSON object metadata as a multipart upload.
+func (h *Handler) TusCreate(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	ctx := r.Context()
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeError(w, r, http.StatusBadRequest, "Upload-Length header is required")
+		return
+	}
+	if length > tusMaxSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "Upload-Length exceeds Tus-Max-Size")
+		return
+	}
+
+	rawMetadata := r.Header.Get("Upload-Metadata")
+	tusMetadata, err := parseTusMetadata(rawMetadata)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid Upload-Metadata")
+		return
+	}
+	key := tusMetadata["key"]
+	if key == "" {
+		key = tusMetadata["filename"]
+	}
+	if key == "" {
+		writeError(w, r, http.StatusBadRequest, "key metadata is required")
+		return
+	}
+	if !principalFromContext(ctx).Allows(auth.OpWrite, bucket, key) {
+		writeError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var metadata map[string]string
+	if metadataStr := tusMetadata["metadata"]; metadataStr != "" {
+		if err = json.Unmarshal([]byte(metadataStr), &metadata); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid metadata JSON")
+			return
+		}
+	}
+
+	upload, err := h.uploads.Create(ctx, &service.TusUpload{
+		Bucket:      bucket,
+		Key:         key,
+		Length:      length,
+		ContentType: tusMetadata["filetype"],
+		Metadata:    metadata,
+		RawMetadata: rawMetadata,
+	})
+	if err != nil {
+		writeTusError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/_uploads/%s/%s", bucket, upload.ID))
+	if !upload.Completed() && r.Header.Get("Content-Type") == tusOffsetOctetStream {
+		upload, err = h.uploads.Write(ctx, bucket, upload.ID, 0, r.Body)
+		if err != nil {
+			writeTusError(w, r, err)
+			return
+		}
+	}
+	if upload.Completed() {
+		if err = h.completeTusUpload(ctx, bucket, upload); err != nil {
+			writeTusError(w, r, err)
+			return
+		}
+	}
+	writeTusUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) TusHead(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	id := chi.URLParam(r, "id")
+
+	upload, err := h.uploads.Get(r.Context(), bucket, id)
+	if err != nil {
+		writeTusError(w, r, err)
+		return
+	}
+	writeTusUploadHeaders(w, upload)
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.RawMetadata != "" {
+		w.Header().Set("Upload-Metadata", upload.RawMetadata)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) TusPatch(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	id := chi.URLParam(r, "id")
+
+	if r.Header.Get("Content-Type") != tusOffsetOctetStream {
+		writeError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be "+tusOffsetOctetStream)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeError(w, r, http.StatusBadRequest, "Upload-Offset header is required")
+		return
+	}
+
+	ctx := r.Context()
+	upload, err := h.uploads.Get(ctx, bucket, id)
+	if err != nil {
+		writeTusError(w, r, err)
+		return
+	}
+	if r.ContentLength > upload.Length-offset {
+		writeTusError(w, r, service.ErrUploadTooLarge)
+		return
+	}
+
+	upload, err = h.uploads.Write(ctx, bucket, id, offset, r.Body)
+	if err != nil {
+		writeTusError(w, r, err)
+		return
+	}
+	if upload.Completed() {
+		if err = h.completeTusUpload(ctx, bucket, upload); err != nil {
+			writeTusError(w, r, err)
+			return
+		}
+	}
+	writeTusUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) TusDelete(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	id := chi.URLParam(r, "id")
+
+	if err := h.uploads.Terminate(r.Context(), bucket, id); err != nil {
+		writeTusError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
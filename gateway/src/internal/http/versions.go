@@ -0,0 +1,156 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/internal/auth"
+	"github.com/storage-gateway/src/internal/service"
+	"github.com/storage-gateway/src/processing"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage"
+)
+
+type versionsResponse struct {
+	Key      string            `json:"key"`
+	Versions []service.Version `json:"versions"`
+}
+
+type restoreResponse struct {
+	VersionID string `json:"versionId"`
+	// PreviousVersionID is the version the restore replaced, empty when the
+	// object had been deleted
+	PreviousVersionID string `json:"previousVersionId,omitempty"`
+}
+
+// settleVersion completes the version kept by KeepVersion before a write or
+// delete: it is backed up when the change succeeded, and dropped when it failed
+// so the versions never show content that was not replaced.
+func (h *Handler) settleVersion(ctx context.Context, bucket string, key string, versionId string, changed bool) {
+	if versionId == "" {
+		return
+	}
+	if changed {
+		queue.EnqueueBackup(queue.BackupJob{
+			Key:       key,
+			Bucket:    bucket,
+			VersionID: versionId,
+		})
+		return
+	}
+	if err := h.files.DeleteVersion(context.WithoutCancel(ctx), bucket, key, versionId); err != nil {
+		slog.Warn("dropping unused version failed", "bucket", bucket, "key", key, "version", versionId, "error", err)
+	}
+}
+
+// authorizeVersions checks that the request may read the previous versions of
+// an object. They outlive deletes, so whatever the read policy of the bucket
+// they need an API key or token allowed to read the key.
+func authorizeVersions(w http.ResponseWriter, r *http.Request, bucket string, key string) bool {
+	principal := principalFromContext(r.Context())
+	if principal == nil {
+		writeError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return false
+	}
+	if !principal.Allows(auth.OpRead, bucket, key) {
+		writeError(w, r, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return false
+	}
+	return true
+}
+
+// getVersion returns a previous version from the internal bucket, or from the
+// backups when it is missing there.
+func (h *Handler) getVersion(ctx context.Context, bucket string, key string, versionId string, opts *storage.GetOptions) (*storage.GetObject, error) {
+	out, err := h.files.GetVersion(ctx, bucket, key, versionId, opts)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return out, err
+	}
+	if backup, backupErr := processing.GetVersionFromBackup(ctx, bucket, key, versionId, opts); !errors.Is(backupErr, storage.ErrNotFound) {
+		return backup, backupErr
+	}
+	return nil, err
+}
+
+// writeVersions writes the versions of an object as JSON, newest first.
+func (h *Handler) writeVersions(w http.ResponseWriter, r *http.Request, bucket string, key string) {
+	versions, err := h.files.ListVersions(r.Context(), bucket, key)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	if len(versions) == 0 {
+		writeStorageError(w, r, storage.ErrNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, versionsResponse{Key: key, Versions: versions})
+}
+
+// downloadVersion serves a previous version of an object, cached like the
+// current object of the bucket.
+func (h *Handler) downloadVersion(w http.ResponseWriter, r *http.Request, bucketConfig *config.BucketConfig, bucket string, key string, versionId string) {
+	if !service.ValidVersionId(versionId) {
+		writeError(w, r, http.StatusBadRequest, service.ErrInvalidVersion.Error())
+		return
+	}
+	h.serve(w, r, bucketConfig, func(opts *storage.GetOptions) (*storage.GetObject, bool, error) {
+		out, err := h.getVersion(r.Context(), bucket, key, versionId, opts)
+		return out, false, err
+	})
+}
+
+// RestoreVersion makes a previous version the current object. The replaced
+// object is kept as a version too, so a restore can be undone.
+func (h *Handler) RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	key := chi.URLParam(r, "*")
+	versionId := r.URL.Query().Get("versionId")
+	ctx := r.Context()
+
+	if !service.ValidVersionId(versionId) {
+		writeError(w, r, http.StatusBadRequest, service.ErrInvalidVersion.Error())
+		return
+	}
+	version, err := h.getVersion(ctx, bucket, key, versionId, nil)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	defer version.Body.Close()
+
+	previous, etag, err := h.files.KeepVersion(ctx, bucket, key)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	// The restore only replaces the content kept as the previous version
+	conditions := storage.Conditions{IfMatch: etag}
+	if previous == "" {
+		conditions = storage.Conditions{IfNoneMatch: "*"}
+	}
+	err = h.files.Upload(ctx, bucket, key, version.Body, &storage.PutOptions{
+		ContentType:   version.ContentType,
+		Metadata:      version.Metadata,
+		ContentLength: version.ContentLength,
+		Profile:       config.DisabledProfile,
+		Conditions:    conditions,
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		err = storage.ErrPreconditionFailed
+	}
+	h.settleVersion(ctx, bucket, key, previous, err == nil)
+	if err != nil {
+		writeStorageError(w, r, err)
+		return
+	}
+	h.invalidateDerived(ctx, bucket, key)
+	h.files.DeleteOriginal(ctx, bucket, key)
+	processing.ScheduleProcessing(bucket, key, version.ContentType)
+
+	writeJSON(w, http.StatusOK, restoreResponse{VersionID: versionId, PreviousVersionID: previous})
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+// ExistsOrEvicted reports whether the object exists, also when it was evicted
+// from the primary store of a bucket with a primaryBudget and only its backups
+// hold it.
+func (s *FileService) ExistsOrEvicted(ctx context.Context, bucket string, key string) (bool, error) {
+	exists, err := s.store.Exists(ctx, bucket, key)
+	if err != nil || exists {
+		return exists, err
+	}
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil || bucketConfig.PrimaryBudget <= 0 {
+		return false, err
+	}
+	_, _, release, err := backends.Read(ctx, bucket, func(ctx context.Context, store storage.Storage, backupBucket string) (*storage.ObjectInfo, error) {
+		return store.Stat(ctx, backupBucket, key)
+	}, nil)
+	release()
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RestoreEvicted copies an object evicted from the primary store back from the
+// backups, so conditional writes, versioning and the trash, which work on the
+// primary store, see it. It does nothing for buckets without a primaryBudget,
+// when the primary store holds the object or when no backup has it.
+func (s *FileService) RestoreEvicted(ctx context.Context, bucket string, key string) error {
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil || bucketConfig.PrimaryBudget <= 0 {
+		return err
+	}
+	exists, err := s.store.Exists(ctx, bucket, key)
+	if err != nil || exists {
+		return err
+	}
+	backup, _, release, err := backends.Read(ctx, bucket, func(ctx context.Context, store storage.Storage, backupBucket string) (*storage.GetObject, error) {
+		return store.Get(ctx, backupBucket, key, nil)
+	}, func(obj *storage.GetObject) {
+		obj.Body.Close()
+	})
+	defer release()
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer backup.Body.Close()
+	return backends.RestoreObject(ctx, s.store, bucket, key, backup)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 
+	"github.com/storage-gateway/src/config"
 	"github.com/storage-gateway/src/storage"
 )
 
@@ -15,18 +16,79 @@ func NewFileService(store storage.Storage) *FileService {
 	return &FileService{store: store}
 }
 
+// Upload stores an object in the primary store, optimizing it with the
+// profile named in opts or, when none is given, the bucket's profile. Backups
+// follow in the background, client uploads go through UploadReplicated.
 func (s *FileService) Upload(ctx context.Context, bucket string, key string, r io.Reader, opts *storage.PutOptions) error {
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil {
+		return err
+	}
+	if opts.Profile == "" {
+		opts.Profile = bucketConfig.Profile
+	}
 	return s.store.Put(ctx, bucket, key, r, opts)
 }
 
-func (s *FileService) GetFile(ctx context.Context, bucket string, key string) (*storage.GetObject, error) {
-	return s.store.Get(ctx, bucket, key)
+// UploadReplicated is Upload for client uploads: in buckets with replication
+// the object is written to the backups as well and the upload only succeeds
+// once the quorum stored it. It returns the outcome of each store for those
+// buckets, nil for the others.
+func (s *FileService) UploadReplicated(ctx context.Context, bucket string, key string, r io.Reader, opts *storage.PutOptions) ([]ReplicaResult, error) {
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Profile == "" {
+		opts.Profile = bucketConfig.Profile
+	}
+	if bucketConfig.Replication != nil {
+		return s.replicate(ctx, bucket, key, r, opts, bucketConfig.Replication.Quorum, "")
+	}
+	return nil, s.store.Put(ctx, bucket, key, r, opts)
 }
 
-func (s *FileService) Exists(ctx context.Context, bucket string, key string) bool {
+// Replicate writes an object just created in the primary store, such as a
+// completed resumable upload, to the backups of a bucket with replication and
+// waits for the quorum like UploadReplicated. Other buckets return nil.
+func (s *FileService) Replicate(ctx context.Context, bucket string, key string) ([]ReplicaResult, error) {
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil || bucketConfig.Replication == nil {
+		return nil, err
+	}
+	current, err := s.store.Get(ctx, bucket, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer current.Body.Close()
+	return s.replicate(ctx, bucket, key, current.Body, &storage.PutOptions{
+		ContentType: current.ContentType,
+		Metadata:    current.Metadata,
+		Profile:     config.DisabledProfile,
+	}, bucketConfig.Replication.Quorum, current.ETag)
+}
+
+func (s *FileService) GetFile(ctx context.Context, bucket string, key string, opts *storage.GetOptions) (*storage.GetObject, error) {
+	return s.store.Get(ctx, bucket, key, opts)
+}
+
+func (s *FileService) Exists(ctx context.Context, bucket string, key string) (bool, error) {
 	return s.store.Exists(ctx, bucket, key)
 }
 
+func (s *FileService) Stat(ctx context.Context, bucket string, key string) (*storage.ObjectInfo, error) {
+	return s.store.Stat(ctx, bucket, key)
+}
+
 func (s *FileService) Delete(ctx context.Context, bucket string, key string) error {
 	return s.store.Delete(ctx, bucket, key)
 }
+
+// DeleteIf deletes the object only while it has the ETag conditions.IfMatch.
+func (s *FileService) DeleteIf(ctx context.Context, bucket string, key string, conditions *storage.Conditions) error {
+	return s.store.DeleteIf(ctx, bucket, key, conditions)
+}
+
+func (s *FileService) List(ctx context.Context, bucket string, opts *storage.ListOptions) (*storage.ListResult, error) {
+	return s.store.List(ctx, bucket, opts)
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/storage-gateway/src/storage"
+)
+
+var ErrOriginalNotFound = fmt.Errorf("%w: the original was not kept", storage.ErrNotFound)
+
+// GetOriginal returns the kept original of an object. Objects the optimizer
+// left untouched are returned as they are.
+func (s *FileService) GetOriginal(ctx context.Context, bucket string, key string, opts *storage.GetOptions) (*storage.GetObject, error) {
+	out, err := s.store.Get(ctx, internalBucket(), storage.OriginalKey(bucket, key), opts)
+	if err == nil {
+		return out, nil
+	}
+	out, err = s.store.Get(ctx, bucket, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	if out.Metadata["optimized"] == "true" {
+		out.Body.Close()
+		return nil, ErrOriginalNotFound
+	}
+	return out, nil
+}
+
+func (s *FileService) DeleteOriginal(ctx context.Context, bucket string, key string) error {
+	return s.store.Delete(ctx, internalBucket(), storage.OriginalKey(bucket, key))
+}
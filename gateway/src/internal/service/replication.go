@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+const (
+	ReplicaStored  = "stored"
+	ReplicaFailed  = "failed"
+	ReplicaPending = "pending"
+)
+
+var ErrQuorumNotReached = fmt.Errorf("%w: write quorum not reached", storage.ErrUnavailable)
+
+// ReplicaResult is the outcome of a replicated upload in one store. Stores
+// still writing once the quorum was reached are pending, they complete in
+// the background.
+type ReplicaResult struct {
+	Backend string `json:"backend"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// replicaOutcome is the result of a write to one store. created tells the
+// store did not hold the key before, only then may a rollback delete it.
+type replicaOutcome struct {
+	index   int
+	err     error
+	created bool
+	etag    string
+}
+
+// spool copies the body to a temporary file, so each store reads it at its own
+// pace without holding it in memory.
+func spool(r io.Reader) (*os.File, int64, error) {
+	file, err := os.CreateTemp("", "replica-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(file, r)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, err
+	}
+	return file, size, nil
+}
+
+// writeReplica writes the spooled body to one store. A write without
+// conditions is tried as a create first, so the outcome tells whether the
+// store held the key before.
+func writeReplica(ctx context.Context, store storage.Storage, bucket string, key string, file *os.File, size int64, opts storage.PutOptions) replicaOutcome {
+	if opts.Conditions == (storage.Conditions{}) {
+		create := opts
+		create.Conditions = storage.Conditions{IfNoneMatch: "*"}
+		err := store.Put(ctx, bucket, key, io.NewSectionReader(file, 0, size), &create)
+		if !errors.Is(err, storage.ErrPreconditionFailed) {
+			return replicaOutcome{err: err, created: err == nil, etag: create.ETag}
+		}
+	}
+	err := store.Put(ctx, bucket, key, io.NewSectionReader(file, 0, size), &opts)
+	return replicaOutcome{err: err, created: err == nil && opts.IfNoneMatch == "*", etag: opts.ETag}
+}
+
+// replicate writes an object to the primary store and the bucket's backups in
+// parallel and returns once the primary store and quorum stores in total
+// stored it. A non-empty primaryETag skips the primary store, which already
+// holds the object created by this upload with that ETag. A conditional write
+// reaches the backups only after the primary store accepted it, so a failed
+// condition leaves them untouched; a create also fails on a backup already
+// holding the key.
+//
+// A write that fails is rolled back where it created the object: those stores,
+// the ones still writing included, delete it again while it has the written
+// ETag. Stores where it replaced an object keep the new content, the previous
+// one is gone there anyway.
+func (s *FileService) replicate(ctx context.Context, bucket string, key string, r io.Reader, opts *storage.PutOptions, quorum int, primaryETag string) ([]ReplicaResult, error) {
+	methods, err := config.GetAvailableSecrets(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if quorum > len(methods)+1 {
+		return nil, fmt.Errorf("%w: quorum of %d with %d backups", ErrQuorumNotReached, quorum, len(methods))
+	}
+	file, size, err := spool(r)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryOpts := *opts
+	primaryOpts.ContentLength = size
+	// ETags differ between stores, only the create condition applies to backups
+	replicaOpts := primaryOpts
+	replicaOpts.Conditions = storage.Conditions{IfNoneMatch: opts.IfNoneMatch}
+
+	results := []ReplicaResult{{Backend: "primary", Status: ReplicaPending}}
+	written := []replicaOutcome{}
+	switch {
+	case primaryETag != "":
+		results[0].Status = ReplicaStored
+		written = append(written, replicaOutcome{index: 0, created: true, etag: primaryETag})
+	case opts.Conditions != (storage.Conditions{}):
+		outcome := writeReplica(ctx, s.store, bucket, key, file, size, primaryOpts)
+		if outcome.err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, outcome.err
+		}
+		results[0].Status = ReplicaStored
+		written = append(written, outcome)
+	}
+
+	// Writes outlive the request once the quorum is reached
+	background := context.WithoutCancel(ctx)
+	outcomes := make(chan replicaOutcome, len(methods)+1)
+	var wg sync.WaitGroup
+	write := func(index int, put func() replicaOutcome) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outcome := put()
+			outcome.index = index
+			outcomes <- outcome
+		}()
+	}
+	if results[0].Status == ReplicaPending {
+		write(0, func() replicaOutcome {
+			return writeReplica(background, s.store, bucket, key, file, size, primaryOpts)
+		})
+	}
+	for _, method := range methods {
+		results = append(results, ReplicaResult{Backend: method, Status: ReplicaPending})
+		write(len(results)-1, func() replicaOutcome {
+			store, backupBucket, err := backends.BackupStore(background, method, bucket)
+			if err != nil {
+				return replicaOutcome{err: err}
+			}
+			return writeReplica(background, store, backupBucket, key, file, size, replicaOpts)
+		})
+	}
+	go func() {
+		wg.Wait()
+		file.Close()
+		os.Remove(file.Name())
+	}()
+
+	stored, pending := 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case ReplicaStored:
+			stored++
+		case ReplicaPending:
+			pending++
+		}
+	}
+	var primaryErr error
+collect:
+	for pending > 0 && primaryErr == nil && stored+pending >= quorum {
+		if results[0].Status == ReplicaStored && stored >= quorum {
+			break
+		}
+		var outcome replicaOutcome
+		select {
+		case outcome = <-outcomes:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break collect
+		}
+		pending--
+		if outcome.err != nil {
+			if outcome.index == 0 {
+				primaryErr = outcome.err
+			}
+			results[outcome.index].Status = ReplicaFailed
+			results[outcome.index].Error = outcome.err.Error()
+		} else {
+			results[outcome.index].Status = ReplicaStored
+			written = append(written, outcome)
+			stored++
+		}
+	}
+
+	switch {
+	case err != nil:
+	case primaryErr != nil:
+		err = primaryErr
+	case stored < quorum:
+		err = fmt.Errorf("%w: %d of %d stores", ErrQuorumNotReached, stored, quorum)
+	}
+	if err != nil {
+		names := []string{}
+		for _, result := range results {
+			names = append(names, result.Backend)
+		}
+		go s.rollback(background, bucket, key, names, written, outcomes, pending)
+		return results, err
+	}
+	if pending > 0 {
+		go func() {
+			for range pending {
+				if outcome := <-outcomes; outcome.err != nil {
+					slog.Warn("replica write failed", "bucket", bucket, "key", key, "backend", results[outcome.index].Backend, "error", outcome.err)
+				}
+			}
+		}()
+	}
+	return results, nil
+}
+
+// rollback deletes a failed replicated write from the stores, named by the
+// index of the outcome in names, where it created the object, waiting for the
+// pending ones. Index 0 is the primary store.
+func (s *FileService) rollback(ctx context.Context, bucket string, key string, names []string, written []replicaOutcome, outcomes <-chan replicaOutcome, pending int) {
+	for range pending {
+		if outcome := <-outcomes; outcome.err == nil {
+			written = append(written, outcome)
+		}
+	}
+	for _, outcome := range written {
+		if !outcome.created || outcome.etag == "" {
+			continue
+		}
+		conditions := &storage.Conditions{IfMatch: outcome.etag}
+		var err error
+		if outcome.index == 0 {
+			err = s.store.DeleteIf(ctx, bucket, key, conditions)
+		} else {
+			var store storage.Storage
+			var backupBucket string
+			if store, backupBucket, err = backends.BackupStore(ctx, names[outcome.index], bucket); err == nil {
+				err = store.DeleteIf(ctx, backupBucket, key, conditions)
+			}
+		}
+		if err != nil {
+			slog.Warn("replica rollback failed", "bucket", bucket, "key", key, "backend", names[outcome.index], "error", err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/storage"
+)
+
+var ErrNotInTrash = fmt.Errorf("%w: the object is not in the trash", storage.ErrNotFound)
+
+// TrashedObject is a deleted object of a soft delete bucket. It is purged
+// from the internal bucket and the backups once ExpiresAt passed.
+type TrashedObject struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType,omitempty"`
+	DeletedAt   time.Time `json:"deletedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type TrashList struct {
+	Objects []TrashedObject `json:"objects"`
+	Cursor  string          `json:"cursor,omitempty"`
+}
+
+// Trash moves an object to the trash of its bucket in the internal bucket.
+// Trashing a key again replaces the previous entry. A non-empty etag only
+// trashes the object with that ETag, otherwise the current one is; the object
+// is only deleted while it still holds the trashed content. An object evicted
+// from the primary store is restored to be trashed.
+func (s *FileService) Trash(ctx context.Context, bucket string, key string, etag string) error {
+	if etag == "" {
+		if err := s.RestoreEvicted(ctx, bucket, key); err != nil {
+			return err
+		}
+		current, err := s.store.Stat(ctx, bucket, key)
+		if err != nil {
+			return err
+		}
+		etag = current.ETag
+	}
+	conditions := &storage.Conditions{IfMatch: etag}
+	if err := s.store.Copy(ctx, bucket, key, internalBucket(), storage.TrashKey(bucket, key), conditions); err != nil {
+		return err
+	}
+	return s.store.DeleteIf(ctx, bucket, key, conditions)
+}
+
+// Undelete moves an object back from the trash and returns its content type.
+// It fails with storage.ErrAlreadyExists when the key was reused meanwhile.
+func (s *FileService) Undelete(ctx context.Context, bucket string, key string) (string, error) {
+	trashed, err := s.store.Get(ctx, internalBucket(), storage.TrashKey(bucket, key), nil)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", ErrNotInTrash
+	}
+	if err != nil {
+		return "", err
+	}
+	defer trashed.Body.Close()
+
+	err = s.store.Put(ctx, bucket, key, trashed.Body, &storage.PutOptions{
+		ContentType:   trashed.ContentType,
+		Metadata:      trashed.Metadata,
+		ContentLength: trashed.ContentLength,
+		Profile:       config.DisabledProfile,
+		Conditions:    storage.Conditions{IfNoneMatch: "*"},
+	})
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		return "", storage.ErrAlreadyExists
+	}
+	if err != nil {
+		return "", err
+	}
+	return trashed.ContentType, s.store.Delete(ctx, internalBucket(), storage.TrashKey(bucket, key))
+}
+
+// ListTrash lists the deleted objects of a bucket. The prefix of opts is
+// relative to the bucket, like the returned keys.
+func (s *FileService) ListTrash(ctx context.Context, bucket string, opts *storage.ListOptions, retention time.Duration) (*TrashList, error) {
+	prefix := storage.TrashPrefix(bucket)
+	res, err := s.store.List(ctx, internalBucket(), &storage.ListOptions{
+		Prefix:       prefix + opts.Prefix,
+		Cursor:       opts.Cursor,
+		Limit:        opts.Limit,
+		ContentTypes: opts.ContentTypes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := &TrashList{Objects: []TrashedObject{}, Cursor: res.Cursor}
+	for _, object := range res.Objects {
+		list.Objects = append(list.Objects, TrashedObject{
+			Key:         strings.TrimPrefix(object.Key, prefix),
+			Size:        object.Size,
+			ContentType: object.ContentType,
+			DeletedAt:   object.LastModified,
+			ExpiresAt:   object.LastModified.Add(retention),
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/storage"
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadExpired    = errors.New("upload expired")
+	ErrUploadLocked     = errors.New("upload is locked by another request")
+	ErrOffsetMismatch   = errors.New("upload offset does not match")
+	ErrUploadTooLarge   = errors.New("upload exceeds declared length")
+	ErrKeyAlreadyExists = errors.New("key already exists")
+)
+
+// TusUpload is the state of a resumable upload. It is stored as JSON in the
+// internal bucket until the upload completes, expires or is terminated.
+type TusUpload struct {
+	ID          string            `json:"id"`
+	Bucket      string            `json:"bucket"`
+	Key         string            `json:"key"`
+	Length      int64             `json:"length"`
+	Offset      int64             `json:"offset"`
+	ContentType string            `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	RawMetadata string            `json:"rawMetadata,omitempty"`
+	ExpiresAt   time.Time         `json:"expiresAt"`
+	// Profile is the optimization profile of the bucket, Optimize whether it
+	// optimizes the content type. Optimized uploads are stored as is in the
+	// processing state and optimized by the worker once they complete.
+	Profile  string `json:"profile,omitempty"`
+	Optimize bool   `json:"optimize,omitempty"`
+	// UploadID is the backend multipart upload, created with the first chunk.
+	UploadID string `json:"uploadId,omitempty"`
+	Parts    int32  `json:"parts"`
+	// Pending is the size of the trailing chunk that was too small to become
+	// a multipart part and is kept in the internal bucket until more data arrives.
+	Pending int64 `json:"pending"`
+}
+
+func (u *TusUpload) Completed() bool {
+	return u.Offset == u.Length
+}
+
+func (u *TusUpload) infoKey() string {
+	return "tus/" + u.ID + ".info"
+}
+
+func (u *TusUpload) pendingKey() string {
+	return "tus/" + u.ID + ".part"
+}
+
+type TusService struct {
+	files     *FileService
+	multipart storage.MultipartStorage
+	locks     sync.Map
+}
+
+func NewTusService(files *FileService, multipart storage.MultipartStorage) *TusService {
+	return &TusService{files: files, multipart: multipart}
+}
+
+func internalBucket() string {
+	return config.GetSafeEnv(config.InternalBucket)
+}
+
+func newUploadId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *TusService) Create(ctx context.Context, upload *TusUpload) (*TusUpload, error) {
+	exists, err := s.files.ExistsOrEvicted(ctx, upload.Bucket, upload.Key)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrKeyAlreadyExists
+	}
+	id, err := newUploadId()
+	if err != nil {
+		return nil, err
+	}
+	expiration, err := time.ParseDuration(config.GetSafeEnv(config.TusExpiration))
+	if err != nil {
+		return nil, err
+	}
+	bucketConfig, err := config.GetBucketConfig(upload.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	upload.ID = id
+	upload.Offset = 0
+	upload.ExpiresAt = time.Now().Add(expiration)
+	upload.Profile = bucketConfig.Profile
+
+	if upload.Length == 0 {
+		if err = s.resolveOptimize(upload); err != nil {
+			return nil, err
+		}
+		// Replicated on completion like other uploads. The key was checked
+		// above, do not overwrite an object stored since
+		opts := s.putOptions(upload)
+		opts.Conditions = storage.Conditions{IfNoneMatch: "*"}
+		err = s.files.Upload(ctx, upload.Bucket, upload.Key, bytes.NewReader(nil), opts)
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			return nil, ErrKeyAlreadyExists
+		}
+		if err != nil {
+			return nil, err
+		}
+		return upload, nil
+	}
+	return upload, s.save(ctx, upload)
+}
+
+func (s *TusService) Get(ctx context.Context, bucket string, id string) (*TusUpload, error) {
+	upload := &TusUpload{ID: id}
+	out, err := s.files.GetFile(ctx, internalBucket(), upload.infoKey(), nil)
+	if err != nil {
+		return nil, ErrUploadNotFound
+	}
+	defer out.Body.Close()
+	if err = json.NewDecoder(out.Body).Decode(upload); err != nil {
+		return nil, err
+	}
+	if upload.Bucket != bucket {
+		return nil, ErrUploadNotFound
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		s.remove(ctx, upload)
+		return nil, ErrUploadExpired
+	}
+	return upload, nil
+}
+
+// Write appends the data read from r at the given offset. Data is uploaded in
+// parts of storage.MinPartSize, so memory use is bounded regardless of the
+// request size. Bytes received before a read error are kept, letting the
+// client resume from the returned offset. A completed upload is stored in the
+// primary store only, the caller replicates it.
+func (s *TusService) Write(ctx context.Context, bucket string, id string, offset int64, r io.Reader) (*TusUpload, error) {
+	lock, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	if !mu.TryLock() {
+		return nil, ErrUploadLocked
+	}
+	defer mu.Unlock()
+
+	upload, err := s.Get(ctx, bucket, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	var reader io.Reader = io.LimitReader(r, upload.Length-upload.Offset)
+	if upload.Pending > 0 {
+		pending, err := s.files.GetFile(ctx, internalBucket(), upload.pendingKey(), nil)
+		if err != nil {
+			return nil, err
+		}
+		defer pending.Body.Close()
+		reader = io.MultiReader(pending.Body, reader)
+	}
+
+	if upload.UploadID == "" {
+		buffered := bufio.NewReader(reader)
+		head, _ := buffered.Peek(512)
+		reader = buffered
+		if !strings.HasPrefix(upload.ContentType, "image/") && !strings.HasPrefix(upload.ContentType, "video/") {
+			upload.ContentType = http.DetectContentType(head)
+		}
+		if err = s.resolveOptimize(upload); err != nil {
+			return nil, err
+		}
+		upload.UploadID, err = s.multipart.CreateMultipartUpload(ctx, upload.Bucket, upload.Key, s.putOptions(upload))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	committed := upload.Offset - upload.Pending
+	buf := make([]byte, storage.MinPartSize)
+	var writeErr error
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		last := committed+int64(n) == upload.Length
+		if n == len(buf) || (last && n > 0) {
+			err = s.multipart.UploadPart(ctx, upload.Bucket, upload.Key, upload.UploadID, upload.Parts+1, bytes.NewReader(buf[:n]), int64(n))
+			if err != nil {
+				writeErr = err
+				break
+			}
+			upload.Parts++
+			committed += int64(n)
+			upload.Pending = 0
+			upload.Offset = committed
+		} else if n > 0 {
+			// S3 parts must be at least 5 MiB, keep the short chunk until more data arrives
+			err = s.files.Upload(ctx, internalBucket(), upload.pendingKey(), bytes.NewReader(buf[:n]), &storage.PutOptions{
+				ContentType:   "application/octet-stream",
+				ContentLength: int64(n),
+				Profile:       config.DisabledProfile,
+			})
+			if err != nil {
+				writeErr = err
+				break
+			}
+			upload.Pending = int64(n)
+			upload.Offset = committed + int64(n)
+		}
+		if readErr != nil {
+			if readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+				writeErr = readErr
+			}
+			break
+		}
+		if last {
+			break
+		}
+	}
+
+	if upload.Completed() {
+		// The key was free when the upload was created, do not overwrite an object stored since
+		err = s.multipart.CompleteMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID, &storage.Conditions{IfNoneMatch: "*"})
+		if errors.Is(err, storage.ErrPreconditionFailed) {
+			s.remove(ctx, upload)
+			return nil, ErrKeyAlreadyExists
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.files.Delete(ctx, internalBucket(), upload.infoKey())
+		s.files.Delete(ctx, internalBucket(), upload.pendingKey())
+		s.locks.Delete(id)
+		return upload, writeErr
+	}
+	if err = s.save(ctx, upload); err != nil {
+		return nil, err
+	}
+	return upload, writeErr
+}
+
+func (s *TusService) Terminate(ctx context.Context, bucket string, id string) error {
+	upload, err := s.Get(ctx, bucket, id)
+	if err != nil {
+		return err
+	}
+	return s.remove(ctx, upload)
+}
+
+func (s *TusService) remove(ctx context.Context, upload *TusUpload) error {
+	if upload.UploadID != "" {
+		if err := s.multipart.AbortMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID); err != nil {
+			return err
+		}
+	}
+	if upload.Pending > 0 {
+		s.files.Delete(ctx, internalBucket(), upload.pendingKey())
+	}
+	s.locks.Delete(upload.ID)
+	return s.files.Delete(ctx, internalBucket(), upload.infoKey())
+}
+
+func (s *TusService) save(ctx context.Context, upload *TusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return s.files.Upload(ctx, internalBucket(), upload.infoKey(), bytes.NewReader(data), &storage.PutOptions{
+		ContentType:   "application/json",
+		ContentLength: int64(len(data)),
+		Profile:       config.DisabledProfile,
+	})
+}
+
+// resolveOptimize decides whether the upload is optimized once its content
+// type is known.
+func (s *TusService) resolveOptimize(upload *TusUpload) error {
+	profile, err := config.GetOptimizationProfile(upload.Profile)
+	if err != nil {
+		return err
+	}
+	upload.Optimize = profile.Optimizes(upload.ContentType)
+	return nil
+}
+
+// putOptions stores the upload as is, like other client uploads the worker
+// optimizes it afterwards.
+func (s *TusService) putOptions(upload *TusUpload) *storage.PutOptions {
+	metadata := maps.Clone(upload.Metadata)
+	if upload.Optimize {
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[storage.StateMetadata] = storage.StateProcessing
+	}
+	return &storage.PutOptions{
+		ContentType:   upload.ContentType,
+		Metadata:      metadata,
+		ContentLength: upload.Length,
+		Profile:       config.DisabledProfile,
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/storage-gateway/src/storage"
+)
+
+const versionTimeFormat = "20060102T150405Z"
+
+var (
+	ErrInvalidVersion  = errors.New("invalid version id")
+	ErrVersionNotFound = fmt.Errorf("%w: version not found", storage.ErrNotFound)
+	versionIdPattern   = regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{8}$`)
+)
+
+// Version describes a version of an object. The current version has no id,
+// previous ones are kept in the internal bucket.
+type Version struct {
+	VersionID    string    `json:"versionId,omitempty"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+	IsLatest     bool      `json:"isLatest"`
+}
+
+// newVersionId returns an id starting with the time the version was written,
+// so ids sort by age, followed by a random suffix.
+func newVersionId(modified time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return modified.UTC().Format(versionTimeFormat) + "-" + hex.EncodeToString(b), nil
+}
+
+// ValidVersionId reports whether id is a version id, ids end up in keys so
+// anything else is rejected.
+func ValidVersionId(id string) bool {
+	return versionIdPattern.MatchString(id)
+}
+
+// KeepVersion copies the current object to its previous versions with a copy
+// in the store, and returns the new version's id and the ETag of the copied
+// content, both empty when the object does not exist. The caller pins the
+// write or delete that follows to the ETag, so a version only ever holds
+// content that was replaced, and drops the version with DeleteVersion when
+// that fails. An object evicted from the primary store is restored first.
+func (s *FileService) KeepVersion(ctx context.Context, bucket string, key string) (string, string, error) {
+	if err := s.RestoreEvicted(ctx, bucket, key); err != nil {
+		return "", "", err
+	}
+	current, err := s.store.Stat(ctx, bucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	versionId, err := newVersionId(current.LastModified)
+	if err != nil {
+		return "", "", err
+	}
+	err = s.store.Copy(ctx, bucket, key, internalBucket(), storage.VersionKey(bucket, key, versionId), &storage.Conditions{IfMatch: current.ETag})
+	if errors.Is(err, storage.ErrNotFound) {
+		// The object was deleted since it was read
+		err = storage.ErrPreconditionFailed
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return versionId, current.ETag, nil
+}
+
+// DeleteVersion deletes a previous version from the internal bucket.
+func (s *FileService) DeleteVersion(ctx context.Context, bucket string, key string, versionId string) error {
+	if !ValidVersionId(versionId) {
+		return ErrInvalidVersion
+	}
+	return s.store.Delete(ctx, internalBucket(), storage.VersionKey(bucket, key, versionId))
+}
+
+func (s *FileService) GetVersion(ctx context.Context, bucket string, key string, versionId string, opts *storage.GetOptions) (*storage.GetObject, error) {
+	if !ValidVersionId(versionId) {
+		return nil, ErrInvalidVersion
+	}
+	out, err := s.store.Get(ctx, internalBucket(), storage.VersionKey(bucket, key, versionId), opts)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrVersionNotFound
+	}
+	return out, err
+}
+
+// ListVersions returns the versions of an object, newest first. Deleted
+// objects only have previous versions.
+func (s *FileService) ListVersions(ctx context.Context, bucket string, key string) ([]Version, error) {
+	versions := []Version{}
+	info, err := s.store.Stat(ctx, bucket, key)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		versions = append(versions, Version{
+			Size:         info.Size,
+			ETag:         info.ETag,
+			LastModified: info.LastModified,
+			IsLatest:     true,
+		})
+	}
+
+	prefix := storage.VersionPrefix(bucket, key)
+	opts := &storage.ListOptions{Prefix: prefix, Delimiter: "/"}
+	previous := []Version{}
+	for {
+		res, err := s.store.List(ctx, internalBucket(), opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range res.Objects {
+			versionId := strings.TrimPrefix(object.Key, prefix)
+			if !ValidVersionId(versionId) {
+				continue
+			}
+			modified, _ := time.Parse(versionTimeFormat, versionId[:len(versionTimeFormat)])
+			previous = append(previous, Version{
+				VersionID:    versionId,
+				Size:         object.Size,
+				ETag:         object.ETag,
+				LastModified: modified,
+			})
+		}
+		if res.Cursor == "" {
+			break
+		}
+		opts.Cursor = res.Cursor
+	}
+	slices.SortFunc(previous, func(a, b Version) int {
+		return strings.Compare(b.VersionID, a.VersionID)
+	})
+	return append(versions, previous...), nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 
 	"net/http"
@@ -9,19 +10,28 @@ import (
 	"syscall"
 
 	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/storage-gateway/src/internal/auth"
 	server "github.com/storage-gateway/src/internal/http"
 	"github.com/storage-gateway/src/internal/service"
 	"github.com/storage-gateway/src/queue"
-	"github.com/storage-gateway/src/storage/s3_store"
+	"github.com/storage-gateway/src/storage/backends"
 )
 
 func main() {
 	vips.Startup(nil)
 	asyncClient := queue.InitQueue()
+	if _, err := auth.InitKeyStore(); err != nil {
+		slog.Error("failed to load api keys", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stopWatch := context.WithCancel(context.Background())
+	go backends.WatchSecrets(ctx)
 
-	store := s3_store.GetPrimaryStore()
+	store := backends.Primary()
 	files := service.NewFileService(store)
-	handler := server.NewHandler(files)
+	uploads := service.NewTusService(files, store)
+	handler := server.NewHandler(files, uploads)
 
 	r := server.NewRouter(handler)
 
@@ -39,6 +49,10 @@ func main() {
 		func() error {
 			return asyncClient.Close()
 		},
+		func() error {
+			stopWatch()
+			return nil
+		},
 		func() error {
 			os.Exit(0)
 			return nil
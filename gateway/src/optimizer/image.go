@@ -2,12 +2,14 @@ package optimizer
 
 import (
 	"bytes"
+	"io"
 
 	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/storage-gateway/src/config"
 	"github.com/storage-gateway/src/storage"
 )
 
-func OptimizeImage(object *storage.PutObject) (*storage.PutObject, error) {
+func OptimizeImage(object *storage.PutObject, profile *config.ImageProfile) (*storage.PutObject, error) {
 	contentType := object.ContentType
 	if contentType != "image/jpeg" && contentType != "image/jpg" && contentType != "image/png" {
 		return object, nil
@@ -18,20 +20,35 @@ func OptimizeImage(object *storage.PutObject) (*storage.PutObject, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer img.Close()
+
+	if profile.MaxWidth > 0 || profile.MaxHeight > 0 {
+		maxWidth, maxHeight := profile.MaxWidth, profile.MaxHeight
+		if maxWidth <= 0 {
+			maxWidth = img.Width()
+		}
+		if maxHeight <= 0 {
+			maxHeight = img.Height()
+		}
+		if err = img.ThumbnailWithSize(maxWidth, maxHeight, vips.InterestingNone, vips.SizeDown); err != nil {
+			return nil, err
+		}
+	}
+
 	var data []byte
 
 	if img.HasAlpha() {
 		data, _, err = img.ExportPng(&vips.PngExportParams{
-			StripMetadata: true,
-			Quality:       75,
+			StripMetadata: !profile.KeepMetadata,
+			Quality:       profile.Quality,
 			Interlace:     false,
 			Compression:   8,
 		})
 		contentType = "image/png"
 	} else {
 		data, _, err = img.ExportJpeg(&vips.JpegExportParams{
-			StripMetadata:  true,
-			Quality:        75,
+			StripMetadata:  !profile.KeepMetadata,
+			Quality:        profile.Quality,
 			Interlace:      true,
 			OptimizeCoding: true,
 		})
@@ -52,3 +69,24 @@ func OptimizeImage(object *storage.PutObject) (*storage.PutObject, error) {
 		ContentLength: int64(len(data)),
 	}, nil
 }
+
+// ImageVariant re-encodes an image in one of the modern formats (webp or
+// avif) at the given quality.
+func ImageVariant(r io.Reader, format string, quality int) (*storage.PutObject, error) {
+	img, err := vips.NewImageFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	data, contentType, err := exportImage(img, format, quality)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.PutObject{
+		ContentType:   contentType,
+		Body:          bytes.NewReader(data),
+		Metadata:      map[string]string{"optimized": "true"},
+		ContentLength: int64(len(data)),
+	}, nil
+}
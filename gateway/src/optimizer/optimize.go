@@ -1,24 +1,58 @@
 package optimizer
 
 import (
+	"io"
 	"strings"
 
+	"github.com/storage-gateway/src/config"
 	"github.com/storage-gateway/src/storage"
 )
 
-func Optimize(object *storage.PutObject) (*storage.PutObject, error) {
-	if object.ContentLength < 500*1024 {
+// Optimize compresses images and videos with the given profile. The returned
+// object's Body is an io.Closer when it is backed by a temporary file, callers
+// close it once the object has been stored.
+func Optimize(object *storage.PutObject, profile *config.OptimizationProfile) (*storage.PutObject, error) {
+	if profile.Disabled {
 		return object, nil
 	}
 	if object.Metadata != nil && object.Metadata["optimized"] == "true" {
 		return object, nil
 	}
+	isImage := strings.HasPrefix(object.ContentType, "image/")
+	isVideo := strings.HasPrefix(object.ContentType, "video/")
+	if !isImage && !isVideo {
+		return object, nil
+	}
+
+	// Streamed uploads have no known size, spool them to disk to find it
+	// without buffering the whole body in memory
+	var spooled *tempFile
+	if object.ContentLength <= 0 {
+		file, size, err := spool(object.Body, "upload-*")
+		if err != nil {
+			return nil, err
+		}
+		spooled = file
+		object = &storage.PutObject{
+			ContentType:   object.ContentType,
+			Metadata:      object.Metadata,
+			ContentLength: size,
+			Body:          file,
+		}
+	}
+	if object.ContentLength < profile.Threshold {
+		return object, nil
+	}
 
-	if strings.HasPrefix(object.ContentType, "image/") {
-		return OptimizeImage(object)
+	var result *storage.PutObject
+	var err error
+	if isImage {
+		result, err = OptimizeImage(object, &profile.Image)
+	} else {
+		result, err = OptimizeVideo(object, &profile.Video)
 	}
-	if strings.HasPrefix(object.ContentType, "video/") {
-		return OptimizeVideo(object)
+	if spooled != nil && (err != nil || result.Body != io.Reader(spooled)) {
+		spooled.Close()
 	}
-	return object, nil
+	return result, err
 }
@@ -0,0 +1,35 @@
+package optimizer
+
+import (
+	"io"
+	"os"
+)
+
+// tempFile is a temporary file that is removed once closed, used to hand
+// spooled media to the stores without keeping it in memory.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// spool copies r into a new temporary file and rewinds it.
+func spool(r io.Reader, pattern string) (*tempFile, int64, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, 0, err
+	}
+	file := &tempFile{f}
+	n, err := io.Copy(file, r)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, n, nil
+}
@@ -0,0 +1,125 @@
+package optimizer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/storage-gateway/src/storage"
+)
+
+const DefaultQuality = 75
+
+// TransformOptions describes a derived image. A zero Width or Height is
+// derived from the aspect ratio and an empty Format keeps JPEG, or PNG for
+// images with transparency.
+type TransformOptions struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+var transformContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"webp": "image/webp",
+	"avif": "image/avif",
+}
+
+func ValidFit(fit string) bool {
+	return fit == "cover" || fit == "contain"
+}
+
+func ValidFormat(format string) bool {
+	_, ok := transformContentTypes[format]
+	return ok
+}
+
+// DerivedKey is the deterministic key the variant of key is cached under.
+func (o *TransformOptions) DerivedKey(key string) string {
+	format := o.Format
+	if format == "" {
+		format = "auto"
+	}
+	return fmt.Sprintf("%s.w%d_h%d_%s_q%d.%s", key, o.Width, o.Height, o.Fit, o.Quality, format)
+}
+
+func exportImage(img *vips.ImageRef, format string, quality int) ([]byte, string, error) {
+	if format == "" {
+		format = "jpeg"
+		if img.HasAlpha() {
+			format = "png"
+		}
+	}
+	var data []byte
+	var err error
+	switch format {
+	case "webp":
+		data, _, err = img.ExportWebp(&vips.WebpExportParams{
+			StripMetadata:   true,
+			Quality:         quality,
+			ReductionEffort: 4,
+		})
+	case "avif":
+		data, _, err = img.ExportAvif(&vips.AvifExportParams{
+			StripMetadata: true,
+			Quality:       quality,
+			Effort:        5,
+		})
+	case "png":
+		data, _, err = img.ExportPng(&vips.PngExportParams{
+			StripMetadata: true,
+			Quality:       quality,
+			Compression:   8,
+		})
+	default:
+		data, _, err = img.ExportJpeg(&vips.JpegExportParams{
+			StripMetadata:  true,
+			Quality:        quality,
+			Interlace:      true,
+			OptimizeCoding: true,
+		})
+	}
+	return data, transformContentTypes[format], err
+}
+
+func TransformImage(r io.Reader, opts *TransformOptions) (*storage.PutObject, error) {
+	img, err := vips.NewImageFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	if err = img.AutoRotate(); err != nil {
+		return nil, err
+	}
+	width, height := opts.Width, opts.Height
+	if width == 0 {
+		width = max(img.Width()*height/img.Height(), 1)
+	}
+	if height == 0 {
+		height = max(img.Height()*width/img.Width(), 1)
+	}
+	crop := vips.InterestingNone
+	if opts.Fit == "cover" {
+		crop = vips.InterestingCentre
+	}
+	// Never upscale, a variant larger than its source only wastes space
+	if err = img.ThumbnailWithSize(width, height, crop, vips.SizeDown); err != nil {
+		return nil, err
+	}
+
+	data, contentType, err := exportImage(img, opts.Format, opts.Quality)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.PutObject{
+		ContentType:   contentType,
+		Body:          bytes.NewReader(data),
+		Metadata:      map[string]string{"optimized": "true"},
+		ContentLength: int64(len(data)),
+	}, nil
+}
@@ -0,0 +1,80 @@
+package optimizer
+
+import "testing"
+
+func TestTransformOptionsDerivedKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		opts TransformOptions
+		want string
+	}{
+		{
+			name: "all options",
+			key:  "photos/cat.jpg",
+			opts: TransformOptions{Width: 320, Height: 240, Fit: "cover", Format: "webp", Quality: 60},
+			want: "photos/cat.jpg.w320_h240_cover_q60.webp",
+		},
+		{
+			name: "automatic format",
+			key:  "photos/cat.jpg",
+			opts: TransformOptions{Width: 320, Fit: "contain", Quality: DefaultQuality},
+			want: "photos/cat.jpg.w320_h0_contain_q75.auto",
+		},
+		{
+			name: "height only",
+			key:  "cat.png",
+			opts: TransformOptions{Height: 100, Fit: "contain", Format: "png", Quality: DefaultQuality},
+			want: "cat.png.w0_h100_contain_q75.png",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.DerivedKey(tt.key); got != tt.want {
+				t.Errorf("DerivedKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformOptionsDerivedKeyIsUnique(t *testing.T) {
+	variants := []TransformOptions{
+		{Width: 320, Height: 240, Fit: "cover", Format: "webp", Quality: 60},
+		{Width: 240, Height: 320, Fit: "cover", Format: "webp", Quality: 60},
+		{Width: 320, Height: 240, Fit: "contain", Format: "webp", Quality: 60},
+		{Width: 320, Height: 240, Fit: "cover", Format: "avif", Quality: 60},
+		{Width: 320, Height: 240, Fit: "cover", Format: "webp", Quality: 75},
+		{Width: 320, Height: 240, Fit: "cover", Quality: 60},
+	}
+	seen := map[string]bool{}
+	for _, opts := range variants {
+		key := opts.DerivedKey("cat.jpg")
+		if seen[key] {
+			t.Errorf("%+v shares the key %q with another variant", opts, key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestValidFitAndFormat(t *testing.T) {
+	for _, fit := range []string{"cover", "contain"} {
+		if !ValidFit(fit) {
+			t.Errorf("ValidFit(%q) = false", fit)
+		}
+	}
+	for _, fit := range []string{"", "fill", "Cover"} {
+		if ValidFit(fit) {
+			t.Errorf("ValidFit(%q) = true", fit)
+		}
+	}
+	for _, format := range []string{"jpeg", "png", "webp", "avif"} {
+		if !ValidFormat(format) {
+			t.Errorf("ValidFormat(%q) = false", format)
+		}
+	}
+	for _, format := range []string{"", "jpg", "gif", "auto"} {
+		if ValidFormat(format) {
+			t.Errorf("ValidFormat(%q) = true", format)
+		}
+	}
+}
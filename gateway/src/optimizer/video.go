@@ -1,73 +1,96 @@
 package optimizer
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"time"
 
+	"github.com/storage-gateway/src/config"
 	"github.com/storage-gateway/src/storage"
 )
 
-func OptimizeVideo(object *storage.PutObject) (*storage.PutObject, error) {
+func OptimizeVideo(object *storage.PutObject, profile *config.VideoProfile) (*storage.PutObject, error) {
 	now := time.Now().Unix()
-	inFile, err := os.CreateTemp("", fmt.Sprintf("input-%d-*.mp4", now))
-	if err != nil {
-		return nil, err
-	}
-	defer os.Remove(inFile.Name())
-	defer inFile.Close()
-
-	inData, err := io.ReadAll(object.Body)
-	if err != nil {
-		return nil, err
+	// Reuse the input when it is already on disk, the caller then owns it
+	inFile, spooled := object.Body.(*tempFile)
+	if !spooled {
+		var err error
+		inFile, _, err = spool(object.Body, fmt.Sprintf("input-%d-*.mp4", now))
+		if err != nil {
+			return nil, err
+		}
 	}
-
-	if _, err := inFile.Write(inData); err != nil {
-		return nil, err
+	release := func() {
+		if !spooled {
+			inFile.Close()
+		}
 	}
 
 	outFile, err := os.CreateTemp("", fmt.Sprintf("output-%d-*.mp4", now))
 	if err != nil {
+		release()
 		return nil, err
 	}
-	defer os.Remove(outFile.Name())
-	defer outFile.Close()
+	out := &tempFile{outFile}
 
-	cmd := exec.Command("ffmpeg", "-y",
-		"-i", inFile.Name(),
-		"-vf", "scale='min(1920,iw)':'min(1080,ih)':force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2",
-		"-c:v", "libx264",
-		"-preset", "slow",
-		"-crf", "26",
+	args := []string{"-y", "-i", inFile.Name()}
+	if profile.MaxWidth > 0 && profile.MaxHeight > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale='min(%d,iw)':'min(%d,ih)':force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2", profile.MaxWidth, profile.MaxHeight))
+	}
+	args = append(args,
+		"-c:v", profile.Codec,
+		"-preset", profile.Preset,
+		"-crf", strconv.Itoa(profile.CRF),
 		"-movflags", "frag_keyframe+empty_moov",
 		"-pix_fmt", "yuv420p",
-		"-c:a", "aac",
-		"-b:a", "128k",
-		outFile.Name(),
+		"-c:a", profile.AudioCodec,
+		"-b:a", profile.AudioBitrate,
 	)
+	if !profile.KeepMetadata {
+		args = append(args, "-map_metadata", "-1")
+	}
+	args = append(args, outFile.Name())
+	cmd := exec.Command("ffmpeg", args...)
 
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
+		release()
+		out.Close()
 		return nil, err
 	}
 
-	data, err := os.ReadFile(outFile.Name())
+	info, err := out.Stat()
 	if err != nil {
+		release()
+		out.Close()
 		return nil, err
 	}
 
-	size := int64(len(data))
+	// Keep the original when the encode did not make it smaller
+	size := info.Size()
 	if size >= object.ContentLength {
-		return object, nil
+		out.Close()
+		if _, err := inFile.Seek(0, io.SeekStart); err != nil {
+			release()
+			return nil, err
+		}
+		return &storage.PutObject{
+			Body:          inFile,
+			ContentType:   object.ContentType,
+			Metadata:      object.Metadata,
+			ContentLength: object.ContentLength,
+		}, nil
 	}
+	release()
 
 	obj := &storage.PutObject{
-		Body:          bytes.NewReader(data),
+		Body:          out,
 		ContentType:   "video/mp4",
+		Metadata:      object.Metadata,
 		ContentLength: size,
 	}
 	if obj.Metadata == nil {
@@ -2,72 +2,109 @@ package processing
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 
-	"github.com/storage-gateway/src/config"
 	"github.com/storage-gateway/src/queue"
 	"github.com/storage-gateway/src/storage"
-	"github.com/storage-gateway/src/storage/firebase_store"
-	"github.com/storage-gateway/src/storage/s3_store"
+	"github.com/storage-gateway/src/storage/backends"
 )
 
-func getS3Backup(ctx context.Context, bucket string, key string) (*storage.GetObject, error) {
-	s3ConfigPath, err := config.GetS3ConfigFromPath(bucket)
+func GetBackup(ctx context.Context, method string, bucket string, key string, opts *storage.GetOptions) (*storage.GetObject, error) {
+	store, backupBucket, err := backends.BackupStore(ctx, method, bucket)
 	if err != nil {
 		return nil, err
 	}
-	s3Client, err := s3_store.CreateClient(ctx, s3ConfigPath)
-	if err != nil {
-		return nil, err
+	return store.Get(ctx, backupBucket, key, opts)
+}
+
+func closeBody(obj *storage.GetObject) {
+	if obj != nil {
+		obj.Body.Close()
 	}
-	return s3Client.Get(ctx, bucket, key)
 }
 
-func getFirebaseBackup(ctx context.Context, bucket string, key string) (*storage.GetObject, error) {
-	firebaseConfigPath, projectId, bucketStr, err := config.GetFirebaseConfigFromPath(bucket)
+// releasingBody ends the backup read that returned the body once it is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release context.CancelFunc
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// readObject reads an object from the backups with backends.Read, the
+// returned body releases the read when it is closed.
+func readObject(ctx context.Context, bucket string, read func(ctx context.Context, store storage.Storage, backupBucket string) (*storage.GetObject, error)) (*storage.GetObject, string, error) {
+	obj, method, release, err := backends.Read(ctx, bucket, read, closeBody)
 	if err != nil {
-		return nil, err
-	}
-	firebaseClient, err := firebase_store.CreateClient(ctx, firebaseConfigPath, projectId)
-	if err != nil {
-		return nil, err
+		release()
+		return nil, method, err
 	}
+	obj.Body = &releasingBody{ReadCloser: obj.Body, release: release}
+	return obj, method, nil
+}
 
-	return firebaseClient.Get(ctx, bucketStr, key)
+// notFound names the object missing from every backup, other errors mean a
+// backup failed and are returned as is.
+func notFound(err error, format string, args ...any) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return storage.Wrap(storage.ErrNotFound, fmt.Errorf(format, args...))
+	}
+	return err
 }
 
-func GetBackup(ctx context.Context, method string, bucket string, key string) (*storage.GetObject, error) {
-	if method == "firebase" {
-		return getFirebaseBackup(ctx, bucket, key)
+// StatFromBackup returns the attributes of an object from the backups,
+// without restoring it.
+func StatFromBackup(ctx context.Context, bucket string, key string) (*storage.ObjectInfo, error) {
+	info, _, release, err := backends.Read(ctx, bucket, func(ctx context.Context, store storage.Storage, backupBucket string) (*storage.ObjectInfo, error) {
+		return store.Stat(ctx, backupBucket, key)
+	}, nil)
+	release()
+	if err != nil {
+		return nil, notFound(err, "no backup of %s/%s", bucket, key)
 	}
-	if method == "s3" {
-		return getS3Backup(ctx, bucket, key)
+	return info, nil
+}
+
+// GetVersionFromBackup returns a previous version of an object from the
+// backups, for versions no longer in the internal bucket.
+func GetVersionFromBackup(ctx context.Context, bucket string, key string, versionId string, opts *storage.GetOptions) (*storage.GetObject, error) {
+	obj, _, err := readObject(ctx, bucket, func(ctx context.Context, store storage.Storage, backupBucket string) (*storage.GetObject, error) {
+		return store.Get(ctx, backupBucket, storage.VersionKey(bucket, key, versionId), opts)
+	})
+	if err != nil {
+		return nil, notFound(err, "no backup of version %s of %s/%s", versionId, bucket, key)
 	}
-	return nil, fmt.Errorf("Not a valid credential file: %s", method)
+	return obj, nil
 }
 
-// FetchFromBackup retrieves an object from backup storage using available credentials.
-// It attempts to fetch the object specified by the job's key and bucket using each
-// available authentication method until one succeeds. Upon successful retrieval,
-// it enqueues an upload job to restore the object to primary storage.
-// Returns an error if all credential methods fail to retrieve the backup.
-func FetchFromBackup(ctx context.Context, job *queue.BackupJob) (*storage.GetObject, error) {
+// FetchFromBackup retrieves an object from backup storage. The backups are
+// read by backends.Read, healthy and preferred ones first. Upon successful
+// retrieval, it enqueues an upload job to restore the object to primary
+// storage from the backup that answered.
+// The optional opts are passed to the backend, so ranged reads only transfer
+// the requested bytes while the full object is still restored in the background.
+// Returns storage.ErrNotFound when no backup has the object.
+func FetchFromBackup(ctx context.Context, job *queue.BackupJob, opts *storage.GetOptions) (*storage.GetObject, error) {
 	key, bucket := job.Key, job.Bucket
-	creds, err := config.GetAvailableSecrets(bucket)
-	if err != nil {
+	obj, method, err := readObject(ctx, bucket, func(ctx context.Context, store storage.Storage, backupBucket string) (*storage.GetObject, error) {
+		return store.Get(ctx, backupBucket, key, opts)
+	})
+	if errors.Is(err, storage.ErrInvalidRange) {
 		return nil, err
 	}
-
-	for _, method := range creds {
-		obj, err := GetBackup(ctx, method, bucket, key)
-		if err == nil {
-			queue.EnqueueUpload(queue.UploadJob{
-				Key:    key,
-				Bucket: bucket,
-				Method: method,
-			})
-			return obj, nil
-		}
+	if err != nil {
+		return nil, notFound(err, "no backup of %s/%s", bucket, key)
 	}
-	return nil, fmt.Errorf("No credentials found")
+	queue.EnqueueUpload(queue.UploadJob{
+		Key:    key,
+		Bucket: bucket,
+		Method: method,
+	})
+	return obj, nil
 }
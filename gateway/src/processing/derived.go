@@ -0,0 +1,67 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/storage-gateway/src/storage"
+)
+
+// transformSuffix matches the suffix optimizer.TransformOptions.DerivedKey
+// appends to a key.
+var transformSuffix = regexp.MustCompile(`^\.w\d+_h\d+_[a-z]*_q\d+\.[a-z]+$`)
+
+var transformKey = regexp.MustCompile(`.\.w\d+_h\d+_[a-z]*_q\d+\.[a-z]+$`)
+
+// IsTransformKey reports whether key is a cached transform of another object.
+// Transforms are not backed up, EnsureTransformed generates them again.
+func IsTransformKey(key string) bool {
+	return transformKey.MatchString(key)
+}
+
+// derivedStore is the part of a store InvalidateDerived uses, implemented by
+// the gateway's FileService and the worker's primary store alike.
+type derivedStore interface {
+	List(ctx context.Context, bucket string, opts *storage.ListOptions) (*storage.ListResult, error)
+	Delete(ctx context.Context, bucket string, key string) error
+}
+
+// InvalidateDerived deletes the objects derived from key in one store: its
+// thumbnail, variants, cached transforms and HLS renditions. It runs once an
+// object was overwritten or deleted, so stale copies are not served for the
+// new content or outlive the object. The same keys are removed from the
+// backups by the worker's TypeInvalidateDerived task.
+func InvalidateDerived(ctx context.Context, files derivedStore, bucket string, key string) error {
+	keys := []string{key + ThumbExt}
+	for _, format := range VariantFormats {
+		keys = append(keys, VariantKey(key, format))
+	}
+
+	for _, prefix := range []string{key + ".w", HLSPrefix(key)} {
+		opts := &storage.ListOptions{Prefix: prefix}
+		for {
+			res, err := files.List(ctx, bucket, opts)
+			if err != nil {
+				return err
+			}
+			for _, object := range res.Objects {
+				if strings.HasPrefix(object.Key, HLSPrefix(key)) || transformSuffix.MatchString(strings.TrimPrefix(object.Key, key)) {
+					keys = append(keys, object.Key)
+				}
+			}
+			if res.Cursor == "" {
+				break
+			}
+			opts.Cursor = res.Cursor
+		}
+	}
+
+	for _, derived := range keys {
+		if err := files.Delete(ctx, bucket, derived); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
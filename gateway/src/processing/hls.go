@@ -0,0 +1,139 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HLSExt is appended to a video key to form the prefix of its renditions
+	HLSExt          = ".hls/"
+	HLSMaster       = "master.m3u8"
+	HLSPlaylistType = "application/vnd.apple.mpegurl"
+	HLSSegmentType  = "video/mp2t"
+	hlsSegmentTime  = "6"
+)
+
+// Rendition is one step of the HLS bitrate ladder, bitrates are in kbit/s.
+type Rendition struct {
+	Height       int
+	VideoBitrate int
+	AudioBitrate int
+}
+
+// HLSRenditions is the bitrate ladder, renditions taller than the source are
+// skipped.
+var HLSRenditions = []Rendition{
+	{Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+	{Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Height: 480, VideoBitrate: 1400, AudioBitrate: 128},
+	{Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+}
+
+func HLSPrefix(key string) string {
+	return key + HLSExt
+}
+
+func IsHLSKey(key string) bool {
+	return strings.Contains(key, HLSExt)
+}
+
+// HLSContentType returns the content type of a file of an HLS rendition.
+func HLSContentType(name string) string {
+	if strings.HasSuffix(name, ".m3u8") {
+		return HLSPlaylistType
+	}
+	return HLSSegmentType
+}
+
+func probeVideoSize(ctx context.Context, input string) (int, int, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height",
+		"-of", "csv=p=0:s=x",
+		input,
+	).Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	widthStr, heightStr, _ := strings.Cut(strings.TrimSpace(string(out)), "x")
+	width, err := strconv.Atoi(widthStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := strconv.Atoi(heightStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
+
+// GenerateHLS transcodes the video at input into an HLS ladder in outDir, one
+// directory per rendition next to the master playlist.
+func GenerateHLS(ctx context.Context, input string, outDir string) error {
+	width, height, err := probeVideoSize(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	renditions := []Rendition{}
+	for _, rendition := range HLSRenditions {
+		if rendition.Height <= height {
+			renditions = append(renditions, rendition)
+		}
+	}
+	if len(renditions) == 0 {
+		smallest := HLSRenditions[len(HLSRenditions)-1]
+		smallest.Height = height - height%2
+		renditions = append(renditions, smallest)
+	}
+
+	master := "#EXTM3U\n#EXT-X-VERSION:3\n"
+	for _, rendition := range renditions {
+		name := fmt.Sprintf("%dp", rendition.Height)
+		if err = os.MkdirAll(filepath.Join(outDir, name), 0o755); err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, "ffmpeg", "-y",
+			"-i", input,
+			"-map", "0:v:0",
+			"-map", "0:a:0?",
+			"-vf", fmt.Sprintf("scale=-2:%d", rendition.Height),
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-profile:v", "main",
+			"-pix_fmt", "yuv420p",
+			"-b:v", fmt.Sprintf("%dk", rendition.VideoBitrate),
+			"-maxrate", fmt.Sprintf("%dk", rendition.VideoBitrate*107/100),
+			"-bufsize", fmt.Sprintf("%dk", rendition.VideoBitrate*3/2),
+			// Fixed keyframes so every rendition switches at the same segment boundaries
+			"-force_key_frames", "expr:gte(t,n_forced*"+hlsSegmentTime+")",
+			"-sc_threshold", "0",
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", rendition.AudioBitrate),
+			"-ac", "2",
+			"-map_metadata", "-1",
+			"-f", "hls",
+			"-hls_time", hlsSegmentTime,
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(outDir, name, "segment_%04d.ts"),
+			filepath.Join(outDir, name, "index.m3u8"),
+		)
+		cmd.Stderr = os.Stderr
+		if err = cmd.Run(); err != nil {
+			return err
+		}
+
+		renditionWidth := width * rendition.Height / height
+		renditionWidth -= renditionWidth % 2
+		bandwidth := (rendition.VideoBitrate + rendition.AudioBitrate) * 1000
+		master += fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n%s/index.m3u8\n", bandwidth, renditionWidth, rendition.Height, name)
+	}
+	return os.WriteFile(filepath.Join(outDir, HLSMaster), []byte(master), 0o644)
+}
@@ -0,0 +1,168 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Technical metadata keys written into the object metadata on upload.
+const (
+	MetaWidth       = "width"
+	MetaHeight      = "height"
+	MetaDuration    = "duration"
+	MetaBitrate     = "bitrate"
+	MetaVideoCodec  = "video-codec"
+	MetaAudioCodec  = "audio-codec"
+	MetaFrameRate   = "frame-rate"
+	MetaRotation    = "rotation"
+	MetaOrientation = "orientation"
+	MetaColorSpace  = "color-space"
+)
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+func formatDecimal(f float64) string {
+	return strings.TrimRight(strings.TrimRight(strconv.FormatFloat(f, 'f', 3, 64), "0"), ".")
+}
+
+func parseFrameRate(rate string) string {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n == 0 {
+		return ""
+	}
+	if !ok {
+		return formatDecimal(n)
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return ""
+	}
+	return formatDecimal(n / d)
+}
+
+// ExtractVideoMetadata reads the duration, bitrate, codecs, resolution,
+// frame rate and rotation of the video at path with ffprobe. Rotation is in
+// clockwise degrees.
+func ExtractVideoMetadata(ctx context.Context, path string) (map[string]string, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	).Output()
+	if err != nil {
+		return nil, err
+	}
+	var probe ffprobeOutput
+	if err = json.Unmarshal(out, &probe); err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{}
+	if duration, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		metadata[MetaDuration] = formatDecimal(duration)
+	}
+	if probe.Format.BitRate != "" {
+		metadata[MetaBitrate] = probe.Format.BitRate
+	}
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "video":
+			if _, ok := metadata[MetaVideoCodec]; ok {
+				continue
+			}
+			metadata[MetaVideoCodec] = stream.CodecName
+			metadata[MetaWidth] = strconv.Itoa(stream.Width)
+			metadata[MetaHeight] = strconv.Itoa(stream.Height)
+			if frameRate := parseFrameRate(stream.AvgFrameRate); frameRate != "" {
+				metadata[MetaFrameRate] = frameRate
+			}
+			rotation := 0
+			if rotate, ok := stream.Tags["rotate"]; ok {
+				rotation, _ = strconv.Atoi(rotate)
+			} else if len(stream.SideDataList) > 0 {
+				// The display matrix rotation is counter-clockwise
+				rotation = -int(math.Round(stream.SideDataList[0].Rotation))
+			}
+			metadata[MetaRotation] = strconv.Itoa((rotation%360 + 360) % 360)
+		case "audio":
+			if _, ok := metadata[MetaAudioCodec]; !ok {
+				metadata[MetaAudioCodec] = stream.CodecName
+			}
+		}
+	}
+	return metadata, nil
+}
+
+func colorSpaceName(interpretation vips.Interpretation) string {
+	switch interpretation {
+	case vips.InterpretationSRGB:
+		return "srgb"
+	case vips.InterpretationRGB, vips.InterpretationRGB16:
+		return "rgb"
+	case vips.InterpretationScRGB:
+		return "scrgb"
+	case vips.InterpretationCMYK:
+		return "cmyk"
+	case vips.InterpretationBW, vips.InterpretationGrey16:
+		return "grey"
+	case vips.InterpretationLAB, vips.InterpretationLABQ, vips.InterpretationLABS:
+		return "lab"
+	default:
+		return fmt.Sprintf("other-%d", interpretation)
+	}
+}
+
+// ExtractImageMetadata reads the size, EXIF orientation and color space of
+// the image at path. Width and height are as stored, before orientation.
+func ExtractImageMetadata(path string) (map[string]string, error) {
+	img, err := vips.NewImageFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	return map[string]string{
+		MetaWidth:       strconv.Itoa(img.Width()),
+		MetaHeight:      strconv.Itoa(img.Height()),
+		MetaOrientation: strconv.Itoa(img.Orientation()),
+		MetaColorSpace:  colorSpaceName(img.ColorSpace()),
+	}, nil
+}
+
+// ExtractMetadata reads the technical metadata of the image or video at path,
+// other content types have none.
+func ExtractMetadata(ctx context.Context, path string, contentType string) (map[string]string, error) {
+	if strings.HasPrefix(contentType, "video/") {
+		return ExtractVideoMetadata(ctx, path)
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		return ExtractImageMetadata(path)
+	}
+	return map[string]string{}, nil
+}
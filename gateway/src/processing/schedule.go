@@ -0,0 +1,37 @@
+package processing
+
+import (
+	"strings"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/queue"
+)
+
+// ScheduleProcessing enqueues the background tasks of a stored object: the
+// backup, a thumbnail (and HLS renditions when the bucket enables them) for
+// videos and the modern variants of images.
+func ScheduleProcessing(bucket string, key string, contentType string) {
+	queue.EnqueueBackup(queue.BackupJob{
+		Key:    key,
+		Bucket: bucket,
+	})
+
+	if strings.HasPrefix(contentType, "video/") {
+		queue.EnqueueGenerateThumb(queue.GenerateThumbJob{
+			Key:    key,
+			Bucket: bucket,
+		})
+		if bucketConfig, err := config.GetBucketConfig(bucket); err == nil && bucketConfig.HLS {
+			queue.EnqueueGenerateHLS(queue.GenerateHLSJob{
+				Key:    key,
+				Bucket: bucket,
+			})
+		}
+	}
+	if HasVariants(contentType) {
+		queue.EnqueueGenerateVariants(queue.GenerateVariantsJob{
+			Key:    key,
+			Bucket: bucket,
+		})
+	}
+}
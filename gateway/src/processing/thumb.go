@@ -75,20 +75,22 @@ func GenerateThumb(ctx context.Context, videoFile *storage.GetObject) (*storage.
 	return obj, nil
 }
 
-func FetchAndGenerateThumb(ctx context.Context, fileHandler *service.FileService, job *queue.BackupJob) (*storage.GetObject, error) {
+func FetchAndGenerateThumb(ctx context.Context, fileHandler *service.FileService, job *queue.BackupJob, opts *storage.GetOptions) (*storage.GetObject, error) {
 	key, bucket := job.Key, job.Bucket
 	videoKey := strings.Replace(key, ThumbExt, "", 1)
-	exists := fileHandler.Exists(ctx, bucket, videoKey)
+	exists, err := fileHandler.Exists(ctx, bucket, videoKey)
+	if err != nil {
+		return nil, err
+	}
 	var videoFile *storage.GetObject
-	var err error
 
 	if exists {
-		videoFile, err = fileHandler.GetFile(ctx, bucket, videoKey)
+		videoFile, err = fileHandler.GetFile(ctx, bucket, videoKey, nil)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		videoFile, err = FetchFromBackup(ctx, &queue.BackupJob{Key: videoKey, Bucket: bucket})
+		videoFile, err = FetchFromBackup(ctx, &queue.BackupJob{Key: videoKey, Bucket: bucket}, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -108,7 +110,7 @@ func FetchAndGenerateThumb(ctx context.Context, fileHandler *service.FileService
 		return nil, err
 	}
 
-	obj, err := fileHandler.GetFile(ctx, bucket, key)
+	obj, err := fileHandler.GetFile(ctx, bucket, key, opts)
 	if err != nil {
 		return nil, err
 	}
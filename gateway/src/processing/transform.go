@@ -0,0 +1,63 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/storage-gateway/src/internal/service"
+	"github.com/storage-gateway/src/optimizer"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage"
+)
+
+var ErrNotImage = errors.New("object is not an image")
+
+// EnsureTransformed makes sure the variant of key described by opts exists
+// in the primary store, generating it from the original (fetched from the
+// backups if needed) on the first request. It returns the variant's key.
+func EnsureTransformed(ctx context.Context, fileHandler *service.FileService, bucket string, key string, opts *optimizer.TransformOptions) (string, error) {
+	derivedKey := opts.DerivedKey(key)
+	exists, err := fileHandler.Exists(ctx, bucket, derivedKey)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return derivedKey, nil
+	}
+
+	var source *storage.GetObject
+	exists, err = fileHandler.Exists(ctx, bucket, key)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		source, err = fileHandler.GetFile(ctx, bucket, key, nil)
+	} else {
+		source, err = FetchFromBackup(ctx, &queue.BackupJob{Key: key, Bucket: bucket}, nil)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer source.Body.Close()
+
+	if !strings.HasPrefix(source.ContentType, "image/") {
+		return "", ErrNotImage
+	}
+
+	variant, err := optimizer.TransformImage(source.Body, opts)
+	if err != nil {
+		return "", err
+	}
+	variant.Metadata["source-key"] = key
+
+	err = fileHandler.Upload(ctx, bucket, derivedKey, variant.Body, &storage.PutOptions{
+		ContentType:   variant.ContentType,
+		Metadata:      variant.Metadata,
+		ContentLength: variant.ContentLength,
+	})
+	if err != nil {
+		return "", err
+	}
+	return derivedKey, nil
+}
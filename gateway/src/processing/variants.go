@@ -0,0 +1,57 @@
+package processing
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// VariantFormats are the modern formats generated for uploaded images, in
+// order of preference.
+var VariantFormats = []string{"avif", "webp"}
+
+func VariantKey(key string, format string) string {
+	return key + ".opt." + format
+}
+
+// HasVariants reports whether variants are generated for the content type.
+func HasVariants(contentType string) bool {
+	return contentType == "image/jpeg" || contentType == "image/jpg" || contentType == "image/png"
+}
+
+// MayHaveVariants reports whether variants can exist for key, skipping keys
+// whose extension marks them as something other than an image.
+func MayHaveVariants(key string) bool {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	return contentType == "" || HasVariants(strings.Split(contentType, ";")[0])
+}
+
+// AcceptedVariantFormats returns the variant formats the request's Accept
+// header explicitly allows, in order of preference.
+func AcceptedVariantFormats(r *http.Request) []string {
+	accepted := map[string]bool{}
+	for mediaRange := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(mediaRange), ";")
+		format, ok := strings.CutPrefix(strings.TrimSpace(mediaType), "image/")
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for param := range strings.SplitSeq(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				q, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+		accepted[format] = q > 0
+	}
+
+	formats := []string{}
+	for _, format := range VariantFormats {
+		if accepted[format] {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Last download times are kept in a Redis sorted set per bucket, scored by
+// unix time, for buckets whose primary store is bounded.
+func accessKey(bucket string) string {
+	return "storage-gateway:access:" + bucket
+}
+
+func RecordAccess(ctx context.Context, bucket string, key string) error {
+	return redisClient.ZAdd(ctx, accessKey(bucket), redis.Z{Score: float64(time.Now().Unix()), Member: key}).Err()
+}
+
+func ForgetAccess(ctx context.Context, bucket string, key string) error {
+	return redisClient.ZRem(ctx, accessKey(bucket), key).Err()
+}
+
+// AccessTimes returns the last download time of each key, the zero time for
+// keys never downloaded.
+func AccessTimes(ctx context.Context, bucket string, keys []string) ([]time.Time, error) {
+	times := make([]time.Time, len(keys))
+	if len(keys) == 0 {
+		return times, nil
+	}
+	scores, err := redisClient.ZMScore(ctx, accessKey(bucket), keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, score := range scores {
+		if score > 0 {
+			times[i] = time.Unix(int64(score), 0)
+		}
+	}
+	return times, nil
+}
@@ -50,3 +50,120 @@ func EnqueueGenerateThumb(job GenerateThumbJob) error {
 	_, err = asynqClient.Enqueue(task, asynq.MaxRetry(2), asynq.Timeout(10*time.Minute))
 	return err
 }
+
+func EnqueueGenerateVariants(job GenerateVariantsJob) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	task := asynq.NewTask(TypeGenerateVariants, payload)
+
+	_, err = asynqClient.Enqueue(task, asynq.MaxRetry(2), asynq.Timeout(10*time.Minute))
+	return err
+}
+
+func EnqueueReoptimize(job ReoptimizeJob) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	task := asynq.NewTask(TypeReoptimize, payload)
+
+	_, err = asynqClient.Enqueue(task, asynq.MaxRetry(2), asynq.Timeout(time.Hour))
+	return err
+}
+
+// EnqueueOptimize returns the task id, completed tasks are kept for a day so
+// clients can look up their state.
+func EnqueueOptimize(job OptimizeJob) (string, error) {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	task := asynq.NewTask(TypeOptimizeFile, payload)
+
+	info, err := asynqClient.Enqueue(task, asynq.MaxRetry(2), asynq.Timeout(time.Hour), asynq.Retention(24*time.Hour))
+	if err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
+
+func EnqueueGenerateHLS(job GenerateHLSJob) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	task := asynq.NewTask(TypeGenerateHLS, payload)
+
+	_, err = asynqClient.Enqueue(task, asynq.MaxRetry(2), asynq.Timeout(2*time.Hour))
+	return err
+}
+
+func EnqueueTrash(job TrashJob) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	task := asynq.NewTask(TypeTrashFile, payload)
+
+	_, err = asynqClient.Enqueue(task, asynq.MaxRetry(2), asynq.Timeout(10*time.Minute))
+	return err
+}
+
+func EnqueueInvalidateDerived(job InvalidateDerivedJob) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	task := asynq.NewTask(TypeInvalidateDerived, payload)
+
+	_, err = asynqClient.Enqueue(task, asynq.MaxRetry(2), asynq.Timeout(10*time.Minute))
+	return err
+}
+
+// periodicTask returns a task for Schedule, which enqueues each of its runs
+// once however many workers schedule it.
+func periodicTask(typename string, payload []byte, timeout time.Duration) *asynq.Task {
+	return asynq.NewTask(typename, payload, asynq.MaxRetry(2), asynq.Timeout(timeout))
+}
+
+// PurgeTrashTask is the periodic task scheduled by the worker.
+func PurgeTrashTask() *asynq.Task {
+	return periodicTask(TypePurgeTrash, nil, time.Hour)
+}
+
+// EnqueueLifecycle returns the task id, the report of the run is kept for a
+// day as the task result.
+func EnqueueLifecycle(job LifecycleJob) (string, error) {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	task := asynq.NewTask(TypeApplyLifecycle, payload)
+
+	info, err := asynqClient.Enqueue(task, asynq.MaxRetry(2), asynq.Timeout(6*time.Hour), asynq.Retention(24*time.Hour))
+	if err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
+
+// ApplyLifecycleTask is the periodic task scheduled by the worker, it applies
+// the rules of every bucket.
+func ApplyLifecycleTask() *asynq.Task {
+	payload, _ := json.Marshal(LifecycleJob{})
+	return periodicTask(TypeApplyLifecycle, payload, 6*time.Hour)
+}
+
+// EvictPrimaryTask is the periodic task scheduled by the worker, it bounds the
+// primary store of the buckets with a budget.
+func EvictPrimaryTask() *asynq.Task {
+	return periodicTask(TypeEvictPrimary, nil, time.Hour)
+}
+
+// ReapUploadsTask is the periodic task scheduled by the worker, it removes the
+// state of expired resumable uploads.
+func ReapUploadsTask() *asynq.Task {
+	return periodicTask(TypeReapUploads, nil, time.Hour)
+}
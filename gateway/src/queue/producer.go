@@ -2,14 +2,25 @@ package queue
 
 import (
 	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 	"github.com/storage-gateway/src/config"
 )
 
 var asynqClient *asynq.Client
+var asynqInspector *asynq.Inspector
+var redisClient *redis.Client
 
 func InitQueue() *asynq.Client {
-	asynqClient = asynq.NewClient(asynq.RedisClientOpt{
+	redisOpt := asynq.RedisClientOpt{
 		Addr: config.GetSafeEnv(config.AsynqRedisUrl),
-	})
+	}
+	asynqClient = asynq.NewClient(redisOpt)
+	asynqInspector = asynq.NewInspector(redisOpt)
+	redisClient = redis.NewClient(&redis.Options{Addr: redisOpt.Addr})
 	return asynqClient
 }
+
+// GetTask returns a task of the default queue by id.
+func GetTask(id string) (*asynq.TaskInfo, error) {
+	return asynqInspector.GetTaskInfo("default", id)
+}
@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/robfig/cron/v3"
+)
+
+// periodicRetention keeps a finished periodic run, so a worker whose clock is
+// behind cannot enqueue the same slot again once it is done.
+const periodicRetention = time.Hour
+
+// everySchedule runs at the multiples of its interval since the zero time
+// rather than relative to when the worker started, so every worker computes
+// the same slots for an "@every" spec.
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(s)).Add(time.Duration(s))
+}
+
+func parseSchedule(spec string) (cron.Schedule, error) {
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(every)
+		if err != nil {
+			return nil, err
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("schedule interval must be at least 1s: %s", spec)
+		}
+		return everySchedule(interval), nil
+	}
+	return cron.ParseStandard(spec)
+}
+
+// enqueueSlot enqueues the run of a periodic task due at slot. Its id is made
+// of the task type and the slot, so the run is only enqueued once however
+// many workers schedule it.
+func enqueueSlot(task *asynq.Task, slot time.Time) error {
+	id := task.Type() + ":" + strconv.FormatInt(slot.Unix(), 10)
+	_, err := asynqClient.Enqueue(task, asynq.TaskID(id), asynq.Retention(periodicRetention))
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+	return err
+}
+
+// Schedule enqueues the task on the cron spec until ctx is done. Every worker
+// schedules the periodic tasks; the runs are due at the same times on all of
+// them and enqueued once.
+func Schedule(ctx context.Context, spec string, task *asynq.Task) error {
+	schedule, err := parseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			slot := schedule.Next(time.Now())
+			timer := time.NewTimer(time.Until(slot))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if err := enqueueSlot(task, slot); err != nil {
+				fmt.Println("!!! Scheduling failed: ", task.Type(), " Error: ", err.Error())
+			}
+		}
+	}()
+	return nil
+}
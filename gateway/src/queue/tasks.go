@@ -4,10 +4,22 @@ const TypeBackupFile = "backup:file"
 const TypeUploadFile = "upload:file"
 const TypeDeleteFile = "delete:file"
 const TypeGenerateThumb = "generate:thumb"
+const TypeGenerateVariants = "generate:variants"
+const TypeReoptimize = "reoptimize:prefix"
+const TypeOptimizeFile = "optimize:file"
+const TypeGenerateHLS = "generate:hls"
+const TypeTrashFile = "trash:file"
+const TypePurgeTrash = "purge:trash"
+const TypeApplyLifecycle = "lifecycle:apply"
+const TypeEvictPrimary = "evict:primary"
+const TypeReapUploads = "reap:uploads"
+const TypeInvalidateDerived = "invalidate:derived"
 
 type BackupJob struct {
 	Key    string `json:"key"`
 	Bucket string `json:"bucket"`
+	// VersionID backs up a previous version of the object instead of the current one
+	VersionID string `json:"versionId,omitempty"`
 }
 
 type UploadJob struct {
@@ -19,3 +31,34 @@ type UploadJob struct {
 type DeleteJob = BackupJob
 
 type GenerateThumbJob = BackupJob
+
+type GenerateVariantsJob = BackupJob
+
+type GenerateHLSJob = BackupJob
+
+type TrashJob = BackupJob
+
+// InvalidateDerivedJob deletes the backups of the objects derived from Key.
+type InvalidateDerivedJob = BackupJob
+
+// OptimizeJob optimizes an object stored as uploaded and replaces it.
+type OptimizeJob struct {
+	Key     string `json:"key"`
+	Bucket  string `json:"bucket"`
+	Profile string `json:"profile,omitempty"`
+}
+
+// ReoptimizeJob re-runs optimization for the kept originals under Prefix,
+// with Profile or the bucket's profile when it is empty.
+type ReoptimizeJob struct {
+	Bucket  string `json:"bucket"`
+	Prefix  string `json:"prefix"`
+	Profile string `json:"profile,omitempty"`
+}
+
+// LifecycleJob applies the lifecycle rules of a bucket, or of every bucket
+// when Bucket is empty. A dry run only reports the objects it would expire.
+type LifecycleJob struct {
+	Bucket string `json:"bucket,omitempty"`
+	DryRun bool   `json:"dryRun,omitempty"`
+}
@@ -0,0 +1,132 @@
+// Package backends opens the primary store and the backup stores configured
+// for a bucket, for the gateway and the worker alike. Stores are created once
+// and reused; WatchSecrets rebuilds the ones whose credentials changed.
+package backends
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/firebase_store"
+	"github.com/storage-gateway/src/storage/s3_store"
+)
+
+// Credential files of the backup methods in a bucket's secrets directory.
+var credentialFiles = map[string]string{
+	"firebase": "firebase.json",
+	"s3":       "s3_credentials",
+}
+
+// Primary returns the primary store, configured from the environment.
+var Primary = sync.OnceValue(s3_store.GetPrimaryStore)
+
+type backupClient struct {
+	bucket       string
+	method       string
+	store        *trackedStore
+	backupBucket string
+	file         string
+	fingerprint  fingerprint
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = map[string]*backupClient{}
+)
+
+func clientKey(bucket string, method string) string {
+	return bucket + "/" + method
+}
+
+func credentialPath(method string, bucket string) (string, error) {
+	file, ok := credentialFiles[method]
+	if !ok {
+		return "", fmt.Errorf("Not a valid credential file: %s", method)
+	}
+	return path.Join(config.GetSafeEnv(config.SecretsPath), bucket, file), nil
+}
+
+// createBackupStore creates the client of a credential method from its file.
+func createBackupStore(ctx context.Context, method string, bucket string) (storage.Storage, string, error) {
+	if method == "firebase" {
+		firebaseConfigPath, projectId, bucketStr, err := config.GetFirebaseConfigFromPath(bucket)
+		if err != nil {
+			return nil, "", err
+		}
+		firebaseClient, err := firebase_store.CreateClient(ctx, firebaseConfigPath, projectId)
+		if err != nil {
+			return nil, "", err
+		}
+		return firebaseClient, bucketStr, nil
+	}
+	if method == "s3" {
+		s3ConfigPath, err := config.GetS3ConfigFromPath(bucket)
+		if err != nil {
+			return nil, "", err
+		}
+		s3Client, err := s3_store.CreateClient(ctx, s3ConfigPath)
+		if err != nil {
+			return nil, "", err
+		}
+		return s3Client, bucket, nil
+	}
+	return nil, "", fmt.Errorf("Not a valid credential file: %s", method)
+}
+
+// buildClient creates the client of a credential method and caches it, keyed
+// by the state of its credential file when it was read. The client it
+// replaces is closed once its calls in flight are done.
+func buildClient(ctx context.Context, method string, bucket string) (*backupClient, error) {
+	file, err := credentialPath(method, bucket)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := fingerprintOf(file)
+	if err != nil {
+		return nil, err
+	}
+	// The client outlives the request creating it
+	store, backupBucket, err := createBackupStore(context.WithoutCancel(ctx), method, bucket)
+	if err != nil {
+		return nil, err
+	}
+	client := &backupClient{bucket: bucket, method: method, store: &trackedStore{Storage: store}, backupBucket: backupBucket, file: file, fingerprint: fp}
+
+	clientsMu.Lock()
+	previous := clients[clientKey(bucket, method)]
+	defer clientsMu.Unlock()
+	if previous != nil && previous.fingerprint == fp {
+		// A concurrent first use built it already, the new client was never used
+		client.store.retire()
+		return previous, nil
+	}
+	clients[clientKey(bucket, method)] = client
+	if previous != nil {
+		previous.store.retire()
+	}
+	return client, nil
+}
+
+// BackupStore returns the backup store of a credential method, as listed by
+// config.GetAvailableSecrets, and the name of the bucket in it. The store is
+// created on first use and shared afterwards.
+func BackupStore(ctx context.Context, method string, bucket string) (storage.Storage, string, error) {
+	clientsMu.Lock()
+	client, ok := clients[clientKey(bucket, method)]
+	clientsMu.Unlock()
+	if ok {
+		return client.store, client.backupBucket, nil
+	}
+
+	// Building outside the lock, concurrent first uses may both create the
+	// client and the first one is kept
+	client, err := buildClient(ctx, method, bucket)
+	if err != nil {
+		return nil, "", err
+	}
+	return client.store, client.backupBucket, nil
+}
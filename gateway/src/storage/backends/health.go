@@ -0,0 +1,169 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/storage"
+)
+
+// healthDecay is the weight of the latest request in the moving averages.
+const healthDecay = 0.2
+
+// unhealthyErrorRate is the error rate from which a backup is read last.
+const unhealthyErrorRate = 0.5
+
+// Health of a backup backend of a bucket, tracked by each process from the
+// outcome of its requests. Latency and ErrorRate are moving averages.
+type Health struct {
+	Bucket    string        `json:"bucket"`
+	Backend   string        `json:"backend"`
+	Latency   time.Duration `json:"latency"`
+	ErrorRate float64       `json:"errorRate"`
+	Failures  int           `json:"consecutiveFailures"`
+	// OpenUntil is set while the circuit breaker skips the backend
+	OpenUntil time.Time `json:"openUntil,omitzero"`
+}
+
+var (
+	healthMu sync.Mutex
+	health   = map[string]*Health{}
+)
+
+func healthOf(bucket string, method string) *Health {
+	key := bucket + "/" + method
+	h, ok := health[key]
+	if !ok {
+		h = &Health{Bucket: bucket, Backend: method}
+		health[key] = h
+	}
+	return h
+}
+
+// forgetHealth drops the health of a backup whose credentials changed or were
+// removed.
+func forgetHealth(bucket string, method string) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	delete(health, bucket+"/"+method)
+}
+
+func breakerFailures() int {
+	failures, err := strconv.Atoi(config.GetSafeEnv(config.BackupBreakerFailures))
+	if err != nil || failures < 1 {
+		return 5
+	}
+	return failures
+}
+
+func breakerCooldown() time.Duration {
+	cooldown, err := time.ParseDuration(config.GetSafeEnv(config.BackupBreakerCooldown))
+	if err != nil {
+		return 30 * time.Second
+	}
+	return cooldown
+}
+
+// Record updates the health of a backend after a request. A missing object
+// is a healthy answer, canceled requests are ignored. After
+// BACKUP_BREAKER_FAILURES failures in a row the breaker opens for
+// BACKUP_BREAKER_COOLDOWN.
+func Record(bucket string, method string, latency time.Duration, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	failed := err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrInvalidRange)
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	h := healthOf(bucket, method)
+	if h.Latency == 0 {
+		h.Latency = latency
+	} else {
+		h.Latency = time.Duration((1-healthDecay)*float64(h.Latency) + healthDecay*float64(latency))
+	}
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	h.ErrorRate = (1-healthDecay)*h.ErrorRate + healthDecay*sample
+
+	if !failed {
+		h.Failures = 0
+		h.OpenUntil = time.Time{}
+		return
+	}
+	h.Failures++
+	if h.Failures >= breakerFailures() {
+		h.OpenUntil = time.Now().Add(breakerCooldown())
+	}
+}
+
+// Order returns the backups to read in order: healthy ones first, then by
+// the configured priority, then by latency. Backups with an open breaker are
+// skipped; once its cooldown passed a single request is let through to probe
+// the backup, which closes the breaker on success.
+func Order(bucket string, methods []string, priority []string) []string {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	now := time.Now()
+	ordered := []string{}
+	snapshot := map[string]Health{}
+	for _, method := range methods {
+		h := healthOf(bucket, method)
+		if now.Before(h.OpenUntil) {
+			continue
+		}
+		if !h.OpenUntil.IsZero() {
+			// Half open, hold other requests back until the probe answered
+			h.OpenUntil = now.Add(breakerCooldown())
+		}
+		ordered = append(ordered, method)
+		snapshot[method] = *h
+	}
+
+	rank := func(method string) int {
+		if i := slices.Index(priority, method); i >= 0 {
+			return i
+		}
+		return len(priority)
+	}
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		unhealthyA, unhealthyB := snapshot[a].ErrorRate >= unhealthyErrorRate, snapshot[b].ErrorRate >= unhealthyErrorRate
+		if unhealthyA != unhealthyB {
+			if unhealthyA {
+				return 1
+			}
+			return -1
+		}
+		if rankA, rankB := rank(a), rank(b); rankA != rankB {
+			return rankA - rankB
+		}
+		return int(snapshot[a].Latency - snapshot[b].Latency)
+	})
+	return ordered
+}
+
+// Snapshot returns the health of every backend this process used.
+func Snapshot() []Health {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	snapshot := []Health{}
+	for _, h := range health {
+		snapshot = append(snapshot, *h)
+	}
+	slices.SortFunc(snapshot, func(a, b Health) int {
+		if a.Bucket != b.Bucket {
+			return strings.Compare(a.Bucket, b.Bucket)
+		}
+		return strings.Compare(a.Backend, b.Backend)
+	})
+	return snapshot
+}
@@ -0,0 +1,140 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/storage"
+)
+
+type readResult[T any] struct {
+	index int
+	value T
+	err   error
+}
+
+func hedgeDelay() time.Duration {
+	delay, err := time.ParseDuration(config.GetSafeEnv(config.BackupHedgeDelay))
+	if err != nil {
+		return 300 * time.Millisecond
+	}
+	return delay
+}
+
+// Read reads from the backups of a bucket in the order of Order and returns
+// the first answer with the backend it came from. When a backup is slower
+// than BACKUP_HEDGE_DELAY, or misses or fails, the next one is asked as well;
+// the slower reads are canceled and their late results passed to discard, so
+// it can close what they opened. A zero delay only moves on after a miss or a
+// failure.
+//
+// The winning read's context outlives Read so a body can still be read from
+// it, the returned release ends it and must be called once the answer is no
+// longer used, e.g. when the body is closed. It is never nil.
+//
+// storage.ErrInvalidRange is an answer as well. When no backup has the object
+// the error is storage.ErrNotFound, unless one of them failed, in which case
+// its error is returned.
+func Read[T any](ctx context.Context, bucket string, read func(ctx context.Context, store storage.Storage, backupBucket string) (T, error), discard func(T)) (T, string, context.CancelFunc, error) {
+	var zero T
+	release := func() {}
+	methods, err := config.GetAvailableSecrets(bucket)
+	if err != nil {
+		return zero, "", release, err
+	}
+	var priority []string
+	if bucketConfig, err := config.GetBucketConfig(bucket); err == nil {
+		priority = bucketConfig.BackupPriority
+	}
+	ordered := Order(bucket, methods, priority)
+	if len(ordered) == 0 {
+		if len(methods) == 0 {
+			return zero, "", release, storage.ErrNotFound
+		}
+		return zero, "", release, storage.Wrap(storage.ErrUnavailable, fmt.Errorf("every backup of %s is failing", bucket))
+	}
+
+	results := make(chan readResult[T], len(ordered))
+	// The winner's context stays alive while its body is read, until released
+	cancels := make([]context.CancelFunc, len(ordered))
+	launched, pending := 0, 0
+	launch := func() {
+		index, method := launched, ordered[launched]
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[index] = cancel
+		launched++
+		pending++
+		go func() {
+			start := time.Now()
+			store, backupBucket, err := BackupStore(attemptCtx, method, bucket)
+			var value T
+			if err == nil {
+				value, err = read(attemptCtx, store, backupBucket)
+			}
+			Record(bucket, method, time.Since(start), err)
+			results <- readResult[T]{index: index, value: value, err: err}
+		}()
+	}
+	// abandon cancels the reads still running and discards what they return
+	abandon := func(winner int) {
+		for i, cancel := range cancels[:launched] {
+			if i != winner {
+				cancel()
+			}
+		}
+		go func(pending int) {
+			for range pending {
+				if result := <-results; result.err == nil && discard != nil {
+					discard(result.value)
+				}
+			}
+		}(pending)
+	}
+
+	delay := hedgeDelay()
+	var hedge <-chan time.Time
+	var timer *time.Timer
+	if delay > 0 {
+		timer = time.NewTimer(delay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+	next := func() {
+		if launched < len(ordered) {
+			launch()
+			if timer != nil {
+				timer.Reset(delay)
+			}
+		}
+	}
+
+	next()
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-hedge:
+			next()
+		case result := <-results:
+			pending--
+			if result.err == nil || errors.Is(result.err, storage.ErrInvalidRange) {
+				abandon(result.index)
+				return result.value, ordered[result.index], cancels[result.index], result.err
+			}
+			cancels[result.index]()
+			if !errors.Is(result.err, storage.ErrNotFound) {
+				lastErr = result.err
+			}
+			next()
+		case <-ctx.Done():
+			abandon(-1)
+			return zero, "", release, ctx.Err()
+		}
+	}
+	if lastErr != nil {
+		return zero, "", release, lastErr
+	}
+	return zero, "", release, storage.ErrNotFound
+}
@@ -0,0 +1,34 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"time"
+
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/storage"
+)
+
+// RestoreObject streams an object read from a backup to the primary store.
+// It is only written while the key is free, an object stored meanwhile is
+// newer and kept.
+func RestoreObject(ctx context.Context, primaryStore storage.Storage, bucket string, key string, backup *storage.GetObject) error {
+	metadata := maps.Clone(backup.Metadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata["original-upload-date"] = backup.LastModified.Format(time.RFC1123)
+
+	err := primaryStore.Put(ctx, bucket, key, backup.Body, &storage.PutOptions{
+		ContentType:   backup.ContentType,
+		Metadata:      metadata,
+		ContentLength: backup.ContentLength,
+		Profile:       config.DisabledProfile,
+		Conditions:    storage.Conditions{IfNoneMatch: "*"},
+	})
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		return nil
+	}
+	return err
+}
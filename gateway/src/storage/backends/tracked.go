@@ -0,0 +1,158 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/storage-gateway/src/storage"
+)
+
+// trackedStore counts the calls in flight on a backup store, bodies included
+// until they are closed, so a store replaced or removed by WatchSecrets is
+// closed once its last call is done rather than while it is still read.
+type trackedStore struct {
+	storage.Storage
+
+	mu       sync.Mutex
+	inFlight int
+	retired  bool
+	closed   bool
+}
+
+// errStoreRetired is returned by the calls on a store that WatchSecrets
+// replaced or removed, callers holding it fall back like on any unavailable store.
+var errStoreRetired = storage.Wrap(storage.ErrUnavailable, errors.New("backup store was replaced or removed"))
+
+// acquire counts a call in flight. It runs under the registry lock, which
+// retire is called under too, so a call either starts before the store is
+// retired and delays its closing, or fails.
+func (s *trackedStore) acquire() error {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.retired {
+		return errStoreRetired
+	}
+	s.inFlight++
+	return nil
+}
+
+func (s *trackedStore) release() {
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	s.closeIfUnused()
+}
+
+// retire closes the store once the calls in flight are done, later calls fail
+// with errStoreRetired. It is called under the registry lock once the store
+// is no longer handed out by BackupStore.
+func (s *trackedStore) retire() {
+	s.mu.Lock()
+	s.retired = true
+	s.mu.Unlock()
+	s.closeIfUnused()
+}
+
+func (s *trackedStore) closeIfUnused() {
+	s.mu.Lock()
+	unused := s.retired && !s.closed && s.inFlight == 0
+	if unused {
+		s.closed = true
+	}
+	s.mu.Unlock()
+	if !unused {
+		return
+	}
+	if closer, ok := s.Storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Warn("closing backup store failed", "error", err)
+		}
+	}
+}
+
+// trackedBody releases the Get call that opened it when it is closed.
+type trackedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func (s *trackedStore) Put(ctx context.Context, bucket string, key string, r io.Reader, opts *storage.PutOptions) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.Storage.Put(ctx, bucket, key, r, opts)
+}
+
+func (s *trackedStore) Get(ctx context.Context, bucket string, key string, opts *storage.GetOptions) (*storage.GetObject, error) {
+	if err := s.acquire(); err != nil {
+		return nil, err
+	}
+	obj, err := s.Storage.Get(ctx, bucket, key, opts)
+	if err != nil {
+		s.release()
+		return nil, err
+	}
+	obj.Body = &trackedBody{ReadCloser: obj.Body, release: s.release}
+	return obj, nil
+}
+
+func (s *trackedStore) Delete(ctx context.Context, bucket string, key string) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.Storage.Delete(ctx, bucket, key)
+}
+
+func (s *trackedStore) DeleteIf(ctx context.Context, bucket string, key string, conditions *storage.Conditions) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.Storage.DeleteIf(ctx, bucket, key, conditions)
+}
+
+func (s *trackedStore) Copy(ctx context.Context, srcBucket string, srcKey string, dstBucket string, dstKey string, conditions *storage.Conditions) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.Storage.Copy(ctx, srcBucket, srcKey, dstBucket, dstKey, conditions)
+}
+
+func (s *trackedStore) Exists(ctx context.Context, bucket string, key string) (bool, error) {
+	if err := s.acquire(); err != nil {
+		return false, err
+	}
+	defer s.release()
+	return s.Storage.Exists(ctx, bucket, key)
+}
+
+func (s *trackedStore) Stat(ctx context.Context, bucket string, key string) (*storage.ObjectInfo, error) {
+	if err := s.acquire(); err != nil {
+		return nil, err
+	}
+	defer s.release()
+	return s.Storage.Stat(ctx, bucket, key)
+}
+
+func (s *trackedStore) List(ctx context.Context, bucket string, opts *storage.ListOptions) (*storage.ListResult, error) {
+	if err := s.acquire(); err != nil {
+		return nil, err
+	}
+	defer s.release()
+	return s.Storage.List(ctx, bucket, opts)
+}
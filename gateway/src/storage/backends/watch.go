@@ -0,0 +1,115 @@
+package backends
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path"
+	"time"
+
+	"github.com/storage-gateway/src/config"
+)
+
+// fingerprint tells whether a credential file changed since it was read.
+type fingerprint struct {
+	modTime time.Time
+	size    int64
+}
+
+func fingerprintOf(file string) (fingerprint, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fingerprint{}, err
+	}
+	return fingerprint{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// scanSecrets returns the credential files of every bucket in $SECRETS_PATH.
+func scanSecrets() (map[string]fingerprint, error) {
+	buckets, err := config.GetBuckets()
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]fingerprint{}
+	for _, bucket := range buckets {
+		for _, name := range credentialFiles {
+			file := path.Join(config.GetSafeEnv(config.SecretsPath), bucket, name)
+			if fp, err := fingerprintOf(file); err == nil {
+				files[file] = fp
+			}
+		}
+	}
+	return files, nil
+}
+
+// reload rebuilds the cached clients whose credential file changed and drops
+// the ones whose file was removed, along with their health. Replaced and
+// dropped clients are closed once their calls in flight are done. Clients of
+// added files are created on first use.
+func reload(ctx context.Context, files map[string]fingerprint) {
+	clientsMu.Lock()
+	stale := map[string]*backupClient{}
+	for key, client := range clients {
+		fp, ok := files[client.file]
+		if !ok {
+			delete(clients, key)
+			client.store.retire()
+			forgetHealth(client.bucket, client.method)
+			slog.Info("backup credentials removed", "file", client.file)
+			continue
+		}
+		if fp != client.fingerprint {
+			stale[key] = client
+		}
+	}
+	clientsMu.Unlock()
+
+	for key, client := range stale {
+		// The health of the old credentials says nothing about the new ones
+		forgetHealth(client.bucket, client.method)
+		if _, err := buildClient(ctx, client.method, client.bucket); err != nil {
+			// The next use reports the error rather than the old credentials
+			clientsMu.Lock()
+			if clients[key] == client {
+				delete(clients, key)
+				client.store.retire()
+			}
+			clientsMu.Unlock()
+			slog.Error("failed to reload backup credentials", "file", client.file, "error", err)
+			continue
+		}
+		slog.Info("backup credentials reloaded", "file", client.file)
+	}
+}
+
+// WatchSecrets polls $SECRETS_PATH every SECRETS_WATCH_INTERVAL until ctx is
+// done and keeps the cached backup clients in line with the credential files.
+func WatchSecrets(ctx context.Context) {
+	interval, err := time.ParseDuration(config.GetSafeEnv(config.SecretsWatchInterval))
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+	previous, _ := scanSecrets()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		files, err := scanSecrets()
+		if err != nil {
+			slog.Error("failed to scan secrets", "error", err)
+			continue
+		}
+		for file := range files {
+			if _, ok := previous[file]; !ok {
+				slog.Info("backup credentials added", "file", file)
+			}
+		}
+		previous = files
+		reload(ctx, files)
+	}
+}
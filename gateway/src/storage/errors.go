@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Backends wrap their SDK errors into these kinds, so callers can tell them
+// apart with errors.Is without knowing which backend failed.
+var (
+	ErrNotFound           = errors.New("object not found")
+	ErrAlreadyExists      = errors.New("object already exists")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrAccessDenied       = errors.New("access denied")
+	ErrUnavailable        = errors.New("storage backend unavailable")
+	ErrTooLarge           = errors.New("object too large")
+	ErrInvalidRange       = errors.New("requested range not satisfiable")
+)
+
+// Wrap marks err as being of the given kind, keeping the original error in
+// the chain for logging.
+func Wrap(kind error, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
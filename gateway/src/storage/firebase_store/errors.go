@@ -0,0 +1,49 @@
+package firebase_store
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+
+	internal "github.com/storage-gateway/src/storage"
+)
+
+// mapError wraps a Cloud Storage error into the storage error kinds.
+func mapError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	if errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist) {
+		return internal.Wrap(internal.ErrNotFound, err)
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch status := apiErr.Code; {
+		case status == http.StatusNotFound:
+			return internal.Wrap(internal.ErrNotFound, err)
+		case status == http.StatusPreconditionFailed:
+			return internal.Wrap(internal.ErrPreconditionFailed, err)
+		case status == http.StatusConflict:
+			return internal.Wrap(internal.ErrAlreadyExists, err)
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			return internal.Wrap(internal.ErrAccessDenied, err)
+		case status == http.StatusRequestEntityTooLarge:
+			return internal.Wrap(internal.ErrTooLarge, err)
+		case status == http.StatusRequestedRangeNotSatisfiable:
+			return internal.Wrap(internal.ErrInvalidRange, err)
+		case status == http.StatusTooManyRequests || status >= http.StatusInternalServerError:
+			return internal.Wrap(internal.ErrUnavailable, err)
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return internal.Wrap(internal.ErrUnavailable, err)
+	}
+	return err
+}
@@ -2,50 +2,111 @@ package firebase_store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	"cloud.google.com/go/storage"
-	firebase "firebase.google.com/go"
+	"github.com/storage-gateway/src/config"
 	"github.com/storage-gateway/src/optimizer"
 	internal "github.com/storage-gateway/src/storage"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 type Filer struct {
-	client    *firebase.App
+	opts      []option.ClientOption
 	projectId string
+
+	// The storage client and its connections are shared by every call
+	storageMu sync.Mutex
+	storage   *storage.Client
+	closed    bool
 }
 
-func NewClient(client *firebase.App, projectId string) *Filer {
+var errClosed = internal.Wrap(internal.ErrUnavailable, errors.New("firebase client is closed"))
+
+func NewClient(projectId string, opts ...option.ClientOption) *Filer {
 	return &Filer{
-		client:    client,
+		opts:      opts,
 		projectId: projectId,
 	}
 }
 
+func (s *Filer) storageClient(ctx context.Context) (*storage.Client, error) {
+	s.storageMu.Lock()
+	defer s.storageMu.Unlock()
+	if s.closed {
+		return nil, errClosed
+	}
+	if s.storage == nil {
+		// The client outlives the call, its token refreshes must not be canceled with ctx
+		client, err := storage.NewClient(context.WithoutCancel(ctx), s.opts...)
+		if err != nil {
+			return nil, err
+		}
+		s.storage = client
+	}
+	return s.storage, nil
+}
+
+// Close closes the storage client and its connections, later calls fail
+// rather than open a new client.
+func (s *Filer) Close() error {
+	s.storageMu.Lock()
+	defer s.storageMu.Unlock()
+	s.closed = true
+	if s.storage == nil {
+		return nil
+	}
+	err := s.storage.Close()
+	s.storage = nil
+	return err
+}
+
 func (s *Filer) GetBucket(ctx context.Context, bucketStr string) (*storage.BucketHandle, error) {
-	client, clientError := s.client.Storage(ctx)
+	client, clientError := s.storageClient(ctx)
 	if clientError != nil {
-		return nil, clientError
+		return nil, mapError(clientError)
 	}
 
 	if bucketStr == "default" {
-		return client.Bucket(fmt.Sprintf("%s.appspot.com", s.projectId))
+		return client.Bucket(fmt.Sprintf("%s.appspot.com", s.projectId)), nil
 	} else {
-		bucket, err := client.Bucket(bucketStr)
-		if err != nil {
-			return nil, err
-		}
-		_, err = bucket.Attrs(ctx)
+		bucket := client.Bucket(bucketStr)
+		_, err := bucket.Attrs(ctx)
 		if err != nil {
 			err = bucket.Create(ctx, s.projectId, nil)
 		}
-		return bucket, err
+		return bucket, mapError(err)
 	}
 }
 
-func (s *Filer) Put(ctx context.Context, bucketStr string, key string, r io.Reader, opts internal.PutOptions) error {
+// conditional applies the write conditions to the object handle as a GCS
+// generation precondition. IfMatch is resolved to the generation carrying
+// that ETag, the write then fails if the object changed since.
+func conditional(ctx context.Context, handle *storage.ObjectHandle, conditions *internal.Conditions) (*storage.ObjectHandle, error) {
+	if conditions.IfNoneMatch == "*" {
+		return handle.If(storage.Conditions{DoesNotExist: true}), nil
+	}
+	if conditions.IfMatch == "" {
+		return handle, nil
+	}
+	attrs, err := handle.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, internal.Wrap(internal.ErrPreconditionFailed, err)
+	}
+	if err != nil {
+		return nil, mapError(err)
+	}
+	if conditions.IfMatch != "*" && conditions.IfMatch != attrs.Etag && conditions.IfMatch != `"`+attrs.Etag+`"` {
+		return nil, internal.ErrPreconditionFailed
+	}
+	return handle.If(storage.Conditions{GenerationMatch: attrs.Generation}), nil
+}
+
+func (s *Filer) Put(ctx context.Context, bucketStr string, key string, r io.Reader, opts *internal.PutOptions) error {
 	bucket, err := s.GetBucket(ctx, bucketStr)
 
 	if err != nil {
@@ -53,16 +114,28 @@ func (s *Filer) Put(ctx context.Context, bucketStr string, key string, r io.Read
 	}
 
 	object := &internal.PutObject{
-		ContentType: opts.ContentType,
-		Metadata:    opts.Metadata,
-		Body:        r,
+		ContentType:   opts.ContentType,
+		Metadata:      opts.Metadata,
+		ContentLength: opts.ContentLength,
+		Body:          r,
 	}
-	object, err = optimizer.Optimize(object)
+	profile, err := config.GetOptimizationProfile(opts.Profile)
 	if err != nil {
 		return err
 	}
+	object, err = optimizer.Optimize(object, profile)
+	if err != nil {
+		return err
+	}
+	if closer, ok := object.Body.(io.Closer); ok && object.Body != r {
+		defer closer.Close()
+	}
 
-	wc := bucket.Object(key).NewWriter(ctx)
+	handle, err := conditional(ctx, bucket.Object(key), &opts.Conditions)
+	if err != nil {
+		return err
+	}
+	wc := handle.NewWriter(ctx)
 	if object.Metadata != nil {
 		wc.ObjectAttrs.Metadata = object.Metadata
 	}
@@ -74,17 +147,18 @@ func (s *Filer) Put(ctx context.Context, bucketStr string, key string, r io.Read
 	}
 
 	if _, err = io.Copy(wc, object.Body); err != nil {
-		return fmt.Errorf("io.Copy: %w", err)
+		return mapError(fmt.Errorf("io.Copy: %w", err))
 	}
 	// Data can continue to be added to the file until the writer is closed.
 	if err := wc.Close(); err != nil {
-		return fmt.Errorf("Writer.Close: %w", err)
+		return mapError(fmt.Errorf("Writer.Close: %w", err))
 	}
+	opts.ETag = wc.Attrs().Etag
 
 	return nil
 }
 
-func (s *Filer) Get(ctx context.Context, bucketStr string, key string) (*internal.GetObject, error) {
+func (s *Filer) Get(ctx context.Context, bucketStr string, key string, opts *internal.GetOptions) (*internal.GetObject, error) {
 	bucket, err := s.GetBucket(ctx, bucketStr)
 	if err != nil {
 		return nil, err
@@ -92,21 +166,29 @@ func (s *Filer) Get(ctx context.Context, bucketStr string, key string) (*interna
 	o := bucket.Object(key)
 	attrs, err := o.Attrs(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("object.Attrs: %w", err)
+		return nil, mapError(fmt.Errorf("object.Attrs: %w", err))
+	}
+	var offset, length int64 = 0, -1
+	if opts != nil && opts.Range != nil {
+		offset, length = opts.Range.Offset, opts.Range.Length
+		if offset >= attrs.Size || (offset < 0 && attrs.Size == 0) {
+			return nil, internal.ErrInvalidRange
+		}
 	}
-	rc, err := o.NewReader(ctx)
+	rc, err := o.NewRangeReader(ctx, offset, length)
 	if err != nil {
-		return nil, fmt.Errorf("Object(%q).NewReader: %w", key, err)
+		return nil, mapError(fmt.Errorf("Object(%q).NewRangeReader: %w", key, err))
 	}
-	defer rc.Close()
 
 	return &internal.GetObject{
 		ContentType:   attrs.ContentType,
 		Metadata:      attrs.Metadata,
 		Body:          rc,
-		ContentLength: attrs.Size,
+		ContentLength: rc.Remain(),
 		ETag:          attrs.Etag,
 		LastModified:  attrs.Updated,
+		Size:          attrs.Size,
+		Offset:        rc.Attrs.StartOffset,
 	}, nil
 }
 
@@ -122,32 +204,119 @@ func (s *Filer) Delete(ctx context.Context, bucketStr string, key string) error
 	// if the object's generation number does not match your precondition.
 	attrs, err := o.Attrs(ctx)
 	if err != nil {
-		return fmt.Errorf("object.Attrs: %w", err)
+		return mapError(fmt.Errorf("object.Attrs: %w", err))
 	}
 	o = o.If(storage.Conditions{GenerationMatch: attrs.Generation})
 
-	return o.Delete(ctx)
+	return mapError(o.Delete(ctx))
 }
 
-func (s *Filer) Exists(ctx context.Context, bucketStr string, key string) bool {
+func (s *Filer) DeleteIf(ctx context.Context, bucketStr string, key string, conditions *internal.Conditions) error {
 	bucket, err := s.GetBucket(ctx, bucketStr)
 	if err != nil {
-		return false
+		return err
 	}
 	o := bucket.Object(key)
+	if conditions != nil {
+		if o, err = conditional(ctx, o, &internal.Conditions{IfMatch: conditions.IfMatch}); err != nil {
+			return err
+		}
+	}
+	return mapError(o.Delete(ctx))
+}
 
-	_, err = o.Attrs(ctx)
+func (s *Filer) Copy(ctx context.Context, srcBucketStr string, srcKey string, dstBucketStr string, dstKey string, conditions *internal.Conditions) error {
+	srcBucket, err := s.GetBucket(ctx, srcBucketStr)
 	if err != nil {
-		return false
+		return err
+	}
+	dstBucket, err := s.GetBucket(ctx, dstBucketStr)
+	if err != nil {
+		return err
 	}
-	return true
+	src := srcBucket.Object(srcKey)
+	if conditions != nil {
+		if src, err = conditional(ctx, src, &internal.Conditions{IfMatch: conditions.IfMatch}); err != nil {
+			return err
+		}
+	}
+	_, err = dstBucket.Object(dstKey).CopierFrom(src).Run(ctx)
+	return mapError(err)
 }
 
-func CreateClient(ctx context.Context, configPath string, projectId string) (*Filer, error) {
-	opt := option.WithCredentialsFile(configPath)
-	app, err := firebase.NewApp(ctx, nil, opt)
+func (s *Filer) Exists(ctx context.Context, bucketStr string, key string) (bool, error) {
+	_, err := s.Stat(ctx, bucketStr, key)
+	if errors.Is(err, internal.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Filer) Stat(ctx context.Context, bucketStr string, key string) (*internal.ObjectInfo, error) {
+	bucket, err := s.GetBucket(ctx, bucketStr)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, mapError(fmt.Errorf("object.Attrs: %w", err))
+	}
+	return &internal.ObjectInfo{
+		Key:          key,
+		Size:         attrs.Size,
+		ContentType:  attrs.ContentType,
+		ETag:         attrs.Etag,
+		LastModified: attrs.Updated,
+		Metadata:     attrs.Metadata,
+	}, nil
+}
+
+func (s *Filer) List(ctx context.Context, bucketStr string, opts *internal.ListOptions) (*internal.ListResult, error) {
+	bucket, err := s.GetBucket(ctx, bucketStr)
+	if err != nil {
+		return nil, err
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	it := bucket.Objects(ctx, &storage.Query{
+		Prefix:    opts.Prefix,
+		Delimiter: opts.Delimiter,
+	})
+	var page []*storage.ObjectAttrs
+	cursor, err := iterator.NewPager(it, limit, opts.Cursor).NextPage(&page)
 	if err != nil {
+		return nil, mapError(fmt.Errorf("bucket.Objects: %w", err))
+	}
+
+	result := &internal.ListResult{
+		Objects:  []internal.ObjectInfo{},
+		Prefixes: []string{},
+		Cursor:   cursor,
+	}
+	for _, attrs := range page {
+		if attrs.Prefix != "" {
+			result.Prefixes = append(result.Prefixes, attrs.Prefix)
+			continue
+		}
+		result.Objects = append(result.Objects, internal.ObjectInfo{
+			Key:          attrs.Name,
+			Size:         attrs.Size,
+			ContentType:  attrs.ContentType,
+			ETag:         attrs.Etag,
+			LastModified: attrs.Updated,
+		})
+	}
+	return result, nil
+}
+
+func CreateClient(ctx context.Context, configPath string, projectId string) (*Filer, error) {
+	filer := NewClient(projectId, option.WithCredentialsFile(configPath))
+	// Opening the storage client now reports unreadable credentials to the caller
+	if _, err := filer.storageClient(ctx); err != nil {
 		return nil, err
 	}
-	return NewClient(app, projectId), nil
+	return filer, nil
 }
@@ -0,0 +1,66 @@
+package s3_store
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/aws/smithy-go"
+
+	"github.com/storage-gateway/src/storage"
+)
+
+// mapError wraps an S3 SDK error into the storage error kinds, by error code
+// when the service returned one and by HTTP status otherwise (HEAD responses
+// have no body to carry a code).
+func mapError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NoSuchBucket", "NoSuchUpload", "NotFound":
+			return storage.Wrap(storage.ErrNotFound, err)
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return storage.Wrap(storage.ErrPreconditionFailed, err)
+		case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "AllAccessDisabled":
+			return storage.Wrap(storage.ErrAccessDenied, err)
+		case "EntityTooLarge":
+			return storage.Wrap(storage.ErrTooLarge, err)
+		case "InvalidRange":
+			return storage.Wrap(storage.ErrInvalidRange, err)
+		case "BucketAlreadyExists", "BucketAlreadyOwnedByYou":
+			return storage.Wrap(storage.ErrAlreadyExists, err)
+		case "SlowDown", "ServiceUnavailable", "InternalError", "RequestTimeout":
+			return storage.Wrap(storage.ErrUnavailable, err)
+		}
+	}
+
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		switch status := respErr.HTTPStatusCode(); {
+		case status == http.StatusNotFound:
+			return storage.Wrap(storage.ErrNotFound, err)
+		case status == http.StatusPreconditionFailed:
+			return storage.Wrap(storage.ErrPreconditionFailed, err)
+		case status == http.StatusForbidden:
+			return storage.Wrap(storage.ErrAccessDenied, err)
+		case status == http.StatusRequestEntityTooLarge:
+			return storage.Wrap(storage.ErrTooLarge, err)
+		case status == http.StatusRequestedRangeNotSatisfiable:
+			return storage.Wrap(storage.ErrInvalidRange, err)
+		case status == http.StatusTooManyRequests || status >= http.StatusInternalServerError:
+			return storage.Wrap(storage.ErrUnavailable, err)
+		}
+	}
+
+	// The request never got a response, the backend could not be reached
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return storage.Wrap(storage.ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package s3_store
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/storage-gateway/src/storage"
+)
+
+func (s *Filer) CreateMultipartUpload(ctx context.Context, bucket string, key string, opts *storage.PutOptions) (string, error) {
+	if err := s.ensureBucket(ctx, bucket); err != nil {
+		return "", err
+	}
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		Metadata: opts.Metadata,
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	out, err := s.S3.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return "", mapError(err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+func (s *Filer) UploadPart(ctx context.Context, bucket string, key string, uploadId string, partNumber int32, r io.Reader, size int64) error {
+	_, err := s.S3.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadId),
+		PartNumber:    aws.Int32(partNumber),
+		Body:          r,
+		ContentLength: aws.Int64(size),
+	})
+	return mapError(err)
+}
+
+func (s *Filer) CompleteMultipartUpload(ctx context.Context, bucket string, key string, uploadId string, conditions *storage.Conditions) error {
+	_, err := s.completeMultipartUpload(ctx, bucket, key, uploadId, conditions)
+	return err
+}
+
+// completeMultipartUpload returns the ETag of the assembled object.
+func (s *Filer) completeMultipartUpload(ctx context.Context, bucket string, key string, uploadId string, conditions *storage.Conditions) (string, error) {
+	parts := []types.CompletedPart{}
+	paginator := s3.NewListPartsPaginator(s.S3, &s3.ListPartsInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadId),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", mapError(err)
+		}
+		for _, part := range page.Parts {
+			parts = append(parts, types.CompletedPart{
+				ETag:       part.ETag,
+				PartNumber: part.PartNumber,
+			})
+		}
+	}
+
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadId),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}
+	if conditions != nil && conditions.IfMatch != "" {
+		input.IfMatch = aws.String(conditions.IfMatch)
+	}
+	if conditions != nil && conditions.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(conditions.IfNoneMatch)
+	}
+	out, err := s.S3.CompleteMultipartUpload(ctx, input)
+	if err != nil {
+		return "", mapError(err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+func (s *Filer) AbortMultipartUpload(ctx context.Context, bucket string, key string, uploadId string) error {
+	_, err := s.S3.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadId),
+	})
+	return mapError(err)
+}
@@ -1,19 +1,30 @@
 package s3_store
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 
+	"github.com/storage-gateway/src/config"
 	"github.com/storage-gateway/src/optimizer"
 	"github.com/storage-gateway/src/storage"
 )
 
 type Filer struct {
 	S3 *s3.Client
+	// transport is set for the clients created by CreateClient, Close closes
+	// its connections
+	transport *http.Transport
 }
 
 func NewClient(client *s3.Client) *Filer {
@@ -22,7 +33,7 @@ func NewClient(client *s3.Client) *Filer {
 	}
 }
 
-func (s *Filer) Put(ctx context.Context, bucket string, key string, r io.Reader, opts *storage.PutOptions) error {
+func (s *Filer) ensureBucket(ctx context.Context, bucket string) error {
 	_, err := s.S3.HeadBucket(ctx, &s3.HeadBucketInput{
 		Bucket: &bucket,
 	})
@@ -32,19 +43,44 @@ func (s *Filer) Put(ctx context.Context, bucket string, key string, r io.Reader,
 			Bucket: &bucket,
 		})
 		if err != nil {
-			return err
+			return mapError(err)
 		}
 	}
+	return nil
+}
+
+func (s *Filer) Put(ctx context.Context, bucket string, key string, r io.Reader, opts *storage.PutOptions) error {
+	err := s.ensureBucket(ctx, bucket)
+	if err != nil {
+		return err
+	}
 	object := &storage.PutObject{
 		ContentType:   opts.ContentType,
 		Metadata:      opts.Metadata,
 		ContentLength: opts.ContentLength,
 		Body:          r,
 	}
-	object, err = optimizer.Optimize(object)
+	profile, err := config.GetOptimizationProfile(opts.Profile)
 	if err != nil {
 		return err
 	}
+	object, err = optimizer.Optimize(object, profile)
+	if err != nil {
+		return err
+	}
+	if closer, ok := object.Body.(io.Closer); ok && object.Body != r {
+		defer closer.Close()
+	}
+	if object.ContentLength <= 0 {
+		opts.ETag, err = s.putStream(ctx, bucket, key, object, &opts.Conditions)
+	} else {
+		opts.ETag, err = s.putObject(ctx, bucket, key, object, &opts.Conditions)
+	}
+	return err
+}
+
+// putObject returns the ETag of the stored object, like putStream.
+func (s *Filer) putObject(ctx context.Context, bucket string, key string, object *storage.PutObject, conditions *storage.Conditions) (string, error) {
 	input := &s3.PutObjectInput{
 		Bucket:   aws.String(bucket),
 		Key:      aws.String(key),
@@ -57,26 +93,101 @@ func (s *Filer) Put(ctx context.Context, bucket string, key string, r io.Reader,
 	if object.ContentType != "" {
 		input.ContentType = aws.String(object.ContentType)
 	}
-	_, err = s.S3.PutObject(ctx, input)
-	return err
+	if conditions.IfMatch != "" {
+		input.IfMatch = aws.String(conditions.IfMatch)
+	}
+	if conditions.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(conditions.IfNoneMatch)
+	}
+	out, err := s.S3.PutObject(ctx, input)
+	if err != nil {
+		return "", mapError(err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+// putStream uploads a body of unknown length in parts, so memory use stays
+// bounded by storage.MinPartSize however large the body is. The conditions
+// are checked when the upload completes. It returns the object's ETag.
+func (s *Filer) putStream(ctx context.Context, bucket string, key string, object *storage.PutObject, conditions *storage.Conditions) (string, error) {
+	buf := make([]byte, storage.MinPartSize)
+	n, err := io.ReadFull(object.Body, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.putObject(ctx, bucket, key, &storage.PutObject{
+			ContentType:   object.ContentType,
+			Metadata:      object.Metadata,
+			ContentLength: int64(n),
+			Body:          bytes.NewReader(buf[:n]),
+		}, conditions)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	uploadId, err := s.CreateMultipartUpload(ctx, bucket, key, &storage.PutOptions{
+		ContentType: object.ContentType,
+		Metadata:    object.Metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+	var partNumber int32
+	for n > 0 {
+		partNumber++
+		if err = s.UploadPart(ctx, bucket, key, uploadId, partNumber, bytes.NewReader(buf[:n]), int64(n)); err != nil {
+			s.AbortMultipartUpload(ctx, bucket, key, uploadId)
+			return "", err
+		}
+		n, err = io.ReadFull(object.Body, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.AbortMultipartUpload(ctx, bucket, key, uploadId)
+			return "", err
+		}
+	}
+	etag, err := s.completeMultipartUpload(ctx, bucket, key, uploadId, conditions)
+	if err != nil {
+		s.AbortMultipartUpload(ctx, bucket, key, uploadId)
+		return "", err
+	}
+	return etag, nil
 }
 
-func (s *Filer) Get(ctx context.Context, bucket string, key string) (*storage.GetObject, error) {
-	out, err := s.S3.GetObject(ctx, &s3.GetObjectInput{
+func (s *Filer) Get(ctx context.Context, bucket string, key string, opts *storage.GetOptions) (*storage.GetObject, error) {
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
-	})
+	}
+	if opts != nil && opts.Range != nil {
+		input.Range = aws.String(rangeHeader(opts.Range))
+	}
+	out, err := s.S3.GetObject(ctx, input)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
-	return &storage.GetObject{
-		ContentType:   *out.ContentType,
+	obj := &storage.GetObject{
+		ContentType:   aws.ToString(out.ContentType),
 		Metadata:      out.Metadata,
 		Body:          out.Body,
-		ContentLength: *out.ContentLength,
-		ETag:          *out.ETag,
-		LastModified:  *out.LastModified,
-	}, nil
+		ContentLength: aws.ToInt64(out.ContentLength),
+		ETag:          aws.ToString(out.ETag),
+		LastModified:  aws.ToTime(out.LastModified),
+		Size:          aws.ToInt64(out.ContentLength),
+	}
+	if out.ContentRange != nil {
+		var end int64
+		fmt.Sscanf(*out.ContentRange, "bytes %d-%d/%d", &obj.Offset, &end, &obj.Size)
+	}
+	return obj, nil
+}
+
+func rangeHeader(r *storage.Range) string {
+	if r.Offset < 0 {
+		return fmt.Sprintf("bytes=%d", r.Offset)
+	}
+	if r.Length < 0 {
+		return fmt.Sprintf("bytes=%d-", r.Offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.Offset, r.Offset+r.Length-1)
 }
 
 func (s *Filer) Delete(ctx context.Context, bucket string, key string) error {
@@ -84,25 +195,188 @@ func (s *Filer) Delete(ctx context.Context, bucket string, key string) error {
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
-	return err
+	return mapError(err)
 }
 
-func (s *Filer) Exists(ctx context.Context, bucket string, key string) bool {
-	_, err := s.S3.HeadObject(ctx, &s3.HeadObjectInput{
+func (s *Filer) DeleteIf(ctx context.Context, bucket string, key string, conditions *storage.Conditions) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if conditions != nil && conditions.IfMatch != "" {
+		input.IfMatch = aws.String(conditions.IfMatch)
+	}
+	_, err := s.S3.DeleteObject(ctx, input)
+	return mapError(err)
+}
+
+// maxCopySize is the largest object CopyObject copies in a single request
+const maxCopySize = 5 * 1024 * 1024 * 1024
+
+// Copy copies the object with CopyObject. Larger objects are streamed through
+// a multipart upload, read with the same condition.
+func (s *Filer) Copy(ctx context.Context, srcBucket string, srcKey string, dstBucket string, dstKey string, conditions *storage.Conditions) error {
+	if err := s.ensureBucket(ctx, dstBucket); err != nil {
+		return err
+	}
+	ifMatch := ""
+	if conditions != nil {
+		ifMatch = conditions.IfMatch
+	}
+	info, err := s.Stat(ctx, srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	if ifMatch != "" && ifMatch != "*" && ifMatch != info.ETag {
+		return storage.ErrPreconditionFailed
+	}
+
+	if info.Size > maxCopySize {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(srcBucket),
+			Key:    aws.String(srcKey),
+		}
+		if ifMatch != "" {
+			input.IfMatch = aws.String(ifMatch)
+		}
+		out, err := s.S3.GetObject(ctx, input)
+		if err != nil {
+			return mapError(err)
+		}
+		defer out.Body.Close()
+		_, err = s.putStream(ctx, dstBucket, dstKey, &storage.PutObject{
+			ContentType: aws.ToString(out.ContentType),
+			Metadata:    out.Metadata,
+			Body:        out.Body,
+		}, &storage.Conditions{})
+		return err
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(dstBucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String((&url.URL{Path: srcBucket + "/" + srcKey}).EscapedPath()),
+	}
+	if ifMatch != "" {
+		input.CopySourceIfMatch = aws.String(ifMatch)
+	}
+	_, err = s.S3.CopyObject(ctx, input)
+	return mapError(err)
+}
+
+func (s *Filer) Exists(ctx context.Context, bucket string, key string) (bool, error) {
+	_, err := s.Stat(ctx, bucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Filer) Stat(ctx context.Context, bucket string, key string) (*storage.ObjectInfo, error) {
+	head, err := s.S3.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		return false
+		return nil, mapError(err)
 	}
-	return true
+	return &storage.ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(head.ContentLength),
+		ContentType:  aws.ToString(head.ContentType),
+		ETag:         aws.ToString(head.ETag),
+		LastModified: aws.ToTime(head.LastModified),
+		Metadata:     head.Metadata,
+	}, nil
+}
+
+func (s *Filer) List(ctx context.Context, bucket string, opts *storage.ListOptions) (*storage.ListResult, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}
+	if opts.Prefix != "" {
+		input.Prefix = aws.String(opts.Prefix)
+	}
+	if opts.Delimiter != "" {
+		input.Delimiter = aws.String(opts.Delimiter)
+	}
+	if opts.Cursor != "" {
+		input.ContinuationToken = aws.String(opts.Cursor)
+	}
+	if opts.Limit > 0 {
+		input.MaxKeys = aws.Int32(int32(opts.Limit))
+	}
+	out, err := s.S3.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	result := &storage.ListResult{
+		Objects:  make([]storage.ObjectInfo, len(out.Contents)),
+		Prefixes: []string{},
+		Cursor:   aws.ToString(out.NextContinuationToken),
+	}
+	for _, prefix := range out.CommonPrefixes {
+		result.Prefixes = append(result.Prefixes, aws.ToString(prefix.Prefix))
+	}
+
+	for i, object := range out.Contents {
+		result.Objects[i] = storage.ObjectInfo{
+			Key:          aws.ToString(object.Key),
+			Size:         aws.ToInt64(object.Size),
+			ETag:         aws.ToString(object.ETag),
+			LastModified: aws.ToTime(object.LastModified),
+		}
+	}
+	if !opts.ContentTypes {
+		return result, nil
+	}
+
+	// ListObjectsV2 does not return content types, fetch them with bounded concurrency
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 16)
+	for i := range result.Objects {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(info *storage.ObjectInfo) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if stat, err := s.Stat(ctx, bucket, info.Key); err == nil {
+				info.ContentType = stat.ContentType
+			}
+		}(&result.Objects[i])
+	}
+	wg.Wait()
+
+	return result, nil
 }
 
 func CreateClient(ctx context.Context, configPath string) (*Filer, error) {
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithSharedCredentialsFiles([]string{configPath}))
+	// The client gets its own transport so Close can release its connections
+	transport := awshttp.NewBuildableClient().GetTransport()
+	cfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithSharedCredentialsFiles([]string{configPath}),
+		awsconfig.WithHTTPClient(&http.Client{
+			Transport: transport,
+			// Like the SDK's default client, redirects are answers
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}),
+	)
 	if err != nil {
 		return nil, err
 	}
-	client := s3.NewFromConfig(cfg)
-	return NewClient(client), nil
+	client := NewClient(s3.NewFromConfig(cfg))
+	client.transport = transport
+	return client, nil
+}
+
+// Close closes the idle connections of a client created by CreateClient, the
+// S3 client holds no other resources.
+func (s *Filer) Close() error {
+	if s.transport != nil {
+		s.transport.CloseIdleConnections()
+	}
+	return nil
 }
@@ -13,6 +13,19 @@ type PutOptions struct {
 	ContentType   string            `json:"contentType"`
 	Metadata      map[string]string `json:"metadata"`
 	ContentLength int64             `json:"contentLength"`
+	// Profile names the optimization profile, empty for the default one
+	Profile    string `json:"profile,omitempty"`
+	Conditions `json:"-"`
+	// ETag is set by Put to the ETag of the stored object
+	ETag string `json:"-"`
+}
+
+// Conditions make a write atomic with respect to the stored object. IfMatch
+// only replaces the object with this ETag, IfNoneMatch "*" only creates the
+// object when the key is free. A failed condition is ErrPreconditionFailed.
+type Conditions struct {
+	IfMatch     string
+	IfNoneMatch string
 }
 
 type PutObject struct {
@@ -22,6 +35,17 @@ type PutObject struct {
 	Body          io.Reader
 }
 
+// Range selects part of an object. A negative Offset reads the last -Offset
+// bytes and a negative Length reads until the end of the object.
+type Range struct {
+	Offset int64
+	Length int64
+}
+
+type GetOptions struct {
+	Range *Range
+}
+
 type GetObject struct {
 	ContentType   string
 	Metadata      map[string]string
@@ -29,6 +53,37 @@ type GetObject struct {
 	Body          io.ReadCloser
 	ETag          string
 	LastModified  time.Time
+	// Size is the full object size and Offset the position of Body within it,
+	// they only differ from ContentLength and 0 for ranged reads.
+	Size   int64
+	Offset int64
+}
+
+type ListOptions struct {
+	Prefix    string
+	Delimiter string
+	Cursor    string
+	Limit     int
+	// ContentTypes fills ObjectInfo.ContentType on backends whose listings
+	// lack it, at the cost of one request per object
+	ContentTypes bool
+}
+
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"contentType,omitempty"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+	// Metadata is only filled by Stat
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type ListResult struct {
+	Objects  []ObjectInfo `json:"objects"`
+	Prefixes []string     `json:"prefixes"`
+	// Cursor is the backend continuation token, empty on the last page.
+	Cursor string `json:"cursor,omitempty"`
 }
 
 type Client struct {
@@ -38,7 +93,64 @@ type Client struct {
 
 type Storage interface {
 	Put(ctx context.Context, bucket string, key string, r io.Reader, opts *PutOptions) error
-	Get(ctx context.Context, bucket string, key string) (*GetObject, error)
+	Get(ctx context.Context, bucket string, key string, opts *GetOptions) (*GetObject, error)
 	Delete(ctx context.Context, bucket string, key string) error
-	Exists(ctx context.Context, bucket string, key string) bool
+	// DeleteIf deletes the object only while it has the ETag conditions.IfMatch
+	DeleteIf(ctx context.Context, bucket string, key string, conditions *Conditions) error
+	// Copy copies an object inside the store, without its content passing
+	// through the gateway. conditions.IfMatch applies to the source object.
+	Copy(ctx context.Context, srcBucket string, srcKey string, dstBucket string, dstKey string, conditions *Conditions) error
+	// Exists reports whether the object exists, an error means it is unknown
+	Exists(ctx context.Context, bucket string, key string) (bool, error)
+	// Stat returns the object's attributes and metadata without its body
+	Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error)
+	List(ctx context.Context, bucket string, opts *ListOptions) (*ListResult, error)
+}
+
+// MultipartStorage assembles an object from separately uploaded parts. Every
+// part except the last one must be at least MinPartSize bytes.
+type MultipartStorage interface {
+	CreateMultipartUpload(ctx context.Context, bucket string, key string, opts *PutOptions) (string, error)
+	UploadPart(ctx context.Context, bucket string, key string, uploadId string, partNumber int32, r io.Reader, size int64) error
+	CompleteMultipartUpload(ctx context.Context, bucket string, key string, uploadId string, conditions *Conditions) error
+	AbortMultipartUpload(ctx context.Context, bucket string, key string, uploadId string) error
+}
+
+const MinPartSize = 5 * 1024 * 1024
+
+// StateMetadata tracks the background optimization of an upload, the object
+// is stored as uploaded while it is processing.
+const (
+	StateMetadata   = "state"
+	StateProcessing = "processing"
+	StateOptimized  = "optimized"
+	StateFailed     = "failed"
+)
+
+// OriginalMetadata marks an optimized object whose original is kept.
+const OriginalMetadata = "has-original"
+
+// OriginalKey is the key of an object's original in the internal bucket.
+func OriginalKey(bucket string, key string) string {
+	return "originals/" + bucket + "/" + key
+}
+
+// VersionPrefix is the prefix of an object's previous versions in the
+// internal bucket. Backups keep them under the same keys.
+func VersionPrefix(bucket string, key string) string {
+	return "versions/" + bucket + "/" + key + "/"
+}
+
+func VersionKey(bucket string, key string, versionId string) string {
+	return VersionPrefix(bucket, key) + versionId
+}
+
+// TrashPrefix is the prefix of a bucket's deleted objects in the internal
+// bucket and in the backups.
+func TrashPrefix(bucket string) string {
+	return "trash/" + bucket + "/"
+}
+
+func TrashKey(bucket string, key string) string {
+	return TrashPrefix(bucket) + key
 }
@@ -11,55 +11,27 @@ import (
 	"github.com/storage-gateway/src/config"
 	"github.com/storage-gateway/src/queue"
 	"github.com/storage-gateway/src/storage"
-	"github.com/storage-gateway/src/storage/firebase_store"
-	"github.com/storage-gateway/src/storage/s3_store"
+	"github.com/storage-gateway/src/storage/backends"
 )
 
-func processS3Backup(ctx context.Context, original *storage.PutObject, bucket string, key string) error {
-	s3ConfigPath, err := config.GetS3ConfigFromPath(bucket)
-	if err != nil {
-		return err
-	}
-	s3Client, err := s3_store.CreateClient(ctx, s3ConfigPath)
-	if err != nil {
-		return err
-	}
-	return s3Client.Put(
-		ctx,
-		bucket,
-		key,
-		original.Body,
-		&storage.PutOptions{
-			ContentType:   original.ContentType,
-			Metadata:      original.Metadata,
-			ContentLength: original.ContentLength,
-		})
-}
-
-func processFirebaseBackup(ctx context.Context, original *storage.PutObject, bucket string, key string) error {
-	firebaseConfigPath, projectId, bucketStr, err := config.GetFirebaseConfigFromPath(bucket)
-	if err != nil {
-		return err
-	}
-	firebaseClient, err := firebase_store.CreateClient(ctx, firebaseConfigPath, projectId)
-	if err != nil {
-		return err
-	}
-
-	return firebaseClient.Put(ctx, bucketStr, key, original.Body, storage.PutOptions{ContentType: original.ContentType, Metadata: original.Metadata})
-}
-
 func HandleBackupTask(ctx context.Context, t *asynq.Task) error {
 	var payload queue.BackupJob
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
 		return err
 	}
 	key, bucket := payload.Key, payload.Bucket
-	primaryStore := s3_store.GetPrimaryStore()
+	primaryStore := backends.Primary()
+
+	// Previous versions are read from the internal bucket and kept under the same key in the backups
+	sourceBucket := bucket
+	if payload.VersionID != "" {
+		sourceBucket = config.GetSafeEnv(config.InternalBucket)
+		key = storage.VersionKey(bucket, key, payload.VersionID)
+	}
 
 	fmt.Println("Starting backup: ", key)
 
-	original, err := primaryStore.Get(ctx, bucket, key)
+	original, err := primaryStore.Get(ctx, sourceBucket, key, nil)
 	if err != nil {
 		return err
 	}
@@ -77,20 +49,17 @@ func HandleBackupTask(ctx context.Context, t *asynq.Task) error {
 	}
 
 	for _, method := range creds {
-		obj := &storage.PutObject{
-			Body:          bytes.NewReader(bodyBytes),
-			ContentType:   original.ContentType,
-			Metadata:      original.Metadata,
-			ContentLength: original.ContentLength,
+		store, backupBucket, err := backends.BackupStore(ctx, method, bucket)
+		if err == nil {
+			err = store.Put(ctx, backupBucket, key, bytes.NewReader(bodyBytes), &storage.PutOptions{
+				ContentType:   original.ContentType,
+				Metadata:      original.Metadata,
+				ContentLength: original.ContentLength,
+				Profile:       config.DisabledProfile,
+			})
 		}
-		if method == "firebase" {
-			if err = processFirebaseBackup(ctx, obj, bucket, key); err != nil {
-				fmt.Printf("Error processing firebase backup: %s", err.Error())
-			}
-		} else {
-			if err = processS3Backup(ctx, obj, bucket, key); err != nil {
-				fmt.Printf("Error processing s3 backup: %s", err.Error())
-			}
+		if err != nil {
+			fmt.Printf("Error processing %s backup: %s", method, err.Error())
 		}
 	}
 
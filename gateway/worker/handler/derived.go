@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/processing"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+// HandleInvalidateDerivedTask deletes the backups of the thumbnail, variants,
+// transforms and HLS renditions of an overwritten or deleted object, which
+// would otherwise be restored stale from the backups.
+func HandleInvalidateDerivedTask(ctx context.Context, t *asynq.Task) error {
+	var payload queue.InvalidateDerivedJob
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	key, bucket := payload.Key, payload.Bucket
+
+	fmt.Println("Starting derived objects invalidation: ", key)
+
+	creds, err := config.GetAvailableSecrets(bucket)
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, method := range creds {
+		store, backupBucket, err := backends.BackupStore(ctx, method, bucket)
+		if err == nil {
+			err = processing.InvalidateDerived(ctx, store, backupBucket, key)
+		}
+		if err != nil {
+			fmt.Println("!!! Derived objects invalidation failed: ", method, key, " Error: ", err.Error())
+			errs = append(errs, err)
+		}
+	}
+
+	fmt.Println("Derived objects invalidation done: ", key)
+
+	return errors.Join(errs...)
+}
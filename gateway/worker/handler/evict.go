@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/processing"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+// Eviction frees space down to this share of the budget, so a bucket at its
+// limit is not evicted again on every run.
+const evictionTarget = 0.9
+
+type evictionCandidate struct {
+	key          string
+	size         int64
+	etag         string
+	lastModified time.Time
+	lastAccess   time.Time
+}
+
+// evictionCandidates lists the objects of a bucket with their last download
+// time, or their last write for objects never downloaded, oldest first.
+func evictionCandidates(ctx context.Context, primaryStore storage.Storage, bucket string) ([]evictionCandidate, int64, error) {
+	candidates := []evictionCandidate{}
+	var total int64
+	opts := &storage.ListOptions{}
+	for {
+		result, err := primaryStore.List(ctx, bucket, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		keys := make([]string, len(result.Objects))
+		for i, object := range result.Objects {
+			keys[i] = object.Key
+		}
+		accessed, err := queue.AccessTimes(ctx, bucket, keys)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i, object := range result.Objects {
+			lastAccess := accessed[i]
+			if lastAccess.IsZero() {
+				lastAccess = object.LastModified
+			}
+			candidates = append(candidates, evictionCandidate{
+				key:          object.Key,
+				size:         object.Size,
+				etag:         object.ETag,
+				lastModified: object.LastModified,
+				lastAccess:   lastAccess,
+			})
+			total += object.Size
+		}
+		if result.Cursor == "" {
+			break
+		}
+		opts.Cursor = result.Cursor
+	}
+	slices.SortFunc(candidates, func(a, b evictionCandidate) int {
+		return a.lastAccess.Compare(b.lastAccess)
+	})
+	return candidates, total, nil
+}
+
+// evictBucket deletes least recently used objects from the primary store until
+// the bucket fits its budget. Only objects whose backup holds their content are
+// evicted, they are served from the backups when requested again: the backup
+// has the same size and was written after the primary object, and the delete
+// only applies while the primary object is unchanged. Cached transforms have
+// no backup, they are deleted and generated again when requested.
+func evictBucket(ctx context.Context, primaryStore storage.Storage, bucket string, budget int64) error {
+	candidates, total, err := evictionCandidates(ctx, primaryStore, bucket)
+	if err != nil {
+		return err
+	}
+	target := int64(float64(budget) * evictionTarget)
+	if total <= budget {
+		return nil
+	}
+
+	count := 0
+	for _, candidate := range candidates {
+		if total <= target {
+			break
+		}
+		if !processing.IsTransformKey(candidate.key) {
+			backup, err := processing.StatFromBackup(ctx, bucket, candidate.key)
+			if err != nil || backup.Size != candidate.size || backup.LastModified.Before(candidate.lastModified) {
+				continue
+			}
+		}
+		err = primaryStore.DeleteIf(ctx, bucket, candidate.key, &storage.Conditions{IfMatch: candidate.etag})
+		if err != nil {
+			fmt.Println("!!! Eviction failed: ", candidate.key, " Error: ", err.Error())
+			continue
+		}
+		queue.ForgetAccess(ctx, bucket, candidate.key)
+		total -= candidate.size
+		count++
+	}
+
+	fmt.Println("Evicted: ", bucket, count, "objects,", total, "bytes kept")
+	if total > budget {
+		return fmt.Errorf("%s still uses %d bytes of its %d bytes budget, not enough objects have a backup", bucket, total, budget)
+	}
+	return nil
+}
+
+// HandleEvictPrimaryTask bounds the primary store of every bucket with a
+// primaryBudget.
+func HandleEvictPrimaryTask(ctx context.Context, t *asynq.Task) error {
+	buckets, err := config.GetBuckets()
+	if err != nil {
+		return err
+	}
+	primaryStore := backends.Primary()
+
+	errs := []error{}
+	for _, bucket := range buckets {
+		bucketConfig, err := config.GetBucketConfig(bucket)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if bucketConfig.PrimaryBudget <= 0 {
+			continue
+		}
+
+		fmt.Println("Starting eviction: ", bucket)
+
+		if err = evictBucket(ctx, primaryStore, bucket, bucketConfig.PrimaryBudget); err != nil {
+			fmt.Println("!!! Eviction failed: ", bucket, " Error: ", err.Error())
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/processing"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+func putHLSFile(ctx context.Context, bucket string, key string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = backends.Primary().Put(ctx, bucket, key, file, &storage.PutOptions{
+		ContentType:   processing.HLSContentType(path),
+		ContentLength: info.Size(),
+		Profile:       config.DisabledProfile,
+	})
+	if err != nil {
+		return err
+	}
+	queue.EnqueueBackup(queue.BackupJob{Key: key, Bucket: bucket})
+	return nil
+}
+
+// HandleGenerateHLSTask transcodes a video into an HLS ladder stored under
+// the key's HLS prefix. The master playlist is stored last, so players never
+// see a ladder with missing renditions.
+func HandleGenerateHLSTask(ctx context.Context, t *asynq.Task) error {
+	var payload queue.GenerateHLSJob
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	key, bucket := payload.Key, payload.Bucket
+	prefix := processing.HLSPrefix(key)
+	primaryStore := backends.Primary()
+
+	fmt.Println("Starting HLS generation: ", key)
+
+	videoFile, err := primaryStore.Get(ctx, bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	defer videoFile.Body.Close()
+
+	inFile, err := os.CreateTemp("", "hls-input-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(inFile.Name())
+	defer inFile.Close()
+	if _, err = io.Copy(inFile, videoFile.Body); err != nil {
+		return err
+	}
+
+	outDir, err := os.MkdirTemp("", "hls-output-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outDir)
+
+	if err = processing.GenerateHLS(ctx, inFile.Name(), outDir); err != nil {
+		fmt.Println("!!! HLS generation failed: ", key, " Error: ", err.Error())
+		return err
+	}
+
+	err = filepath.WalkDir(outDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == processing.HLSMaster {
+			return err
+		}
+		name, err := filepath.Rel(outDir, path)
+		if err != nil {
+			return err
+		}
+		return putHLSFile(ctx, bucket, prefix+filepath.ToSlash(name), path)
+	})
+	if err == nil {
+		err = putHLSFile(ctx, bucket, prefix+processing.HLSMaster, filepath.Join(outDir, processing.HLSMaster))
+	}
+
+	if err != nil {
+		fmt.Println("!!! HLS generation failed: ", key, " Error: ", err.Error())
+	} else {
+		fmt.Println("HLS generation done: ", key)
+	}
+
+	return err
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/processing"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+// maxReportedExpirations bounds the report kept as the task result, the
+// counters still cover every object.
+const maxReportedExpirations = 10000
+
+type lifecycleExpiration struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	Rule         string    `json:"rule"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	Backups      bool      `json:"backups,omitempty"`
+}
+
+type lifecycleReport struct {
+	DryRun      bool                  `json:"dryRun"`
+	Objects     int                   `json:"objects"`
+	Bytes       int64                 `json:"bytes"`
+	Expirations []lifecycleExpiration `json:"expirations"`
+	Truncated   bool                  `json:"truncated,omitempty"`
+	Errors      []string              `json:"errors,omitempty"`
+}
+
+func (r *lifecycleReport) add(expiration lifecycleExpiration) {
+	r.Objects++
+	r.Bytes += expiration.Size
+	if len(r.Expirations) < maxReportedExpirations {
+		r.Expirations = append(r.Expirations, expiration)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// expireObject deletes an object, its kept original and, when asked, its
+// backups. Lifecycle expiration is permanent and bypasses the trash. The object
+// is only deleted while it has the ETag it matched the rule with, an object
+// written since fails with storage.ErrPreconditionFailed and is left alone,
+// along with its original and backups.
+func expireObject(ctx context.Context, primaryStore storage.Storage, bucket string, key string, etag string, backups bool) error {
+	err := primaryStore.DeleteIf(ctx, bucket, key, &storage.Conditions{IfMatch: etag})
+	if errors.Is(err, storage.ErrNotFound) {
+		err = storage.ErrPreconditionFailed
+	}
+	if err != nil {
+		return err
+	}
+	if err := processing.InvalidateDerived(ctx, primaryStore, bucket, key); err != nil {
+		fmt.Println("!!! Derived objects invalidation failed: ", key, " Error: ", err.Error())
+	}
+	primaryStore.Delete(ctx, config.GetSafeEnv(config.InternalBucket), storage.OriginalKey(bucket, key))
+	queue.ForgetAccess(ctx, bucket, key)
+	if !backups {
+		return nil
+	}
+
+	creds, err := config.GetAvailableSecrets(bucket)
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, method := range creds {
+		store, backupBucket, err := backends.BackupStore(ctx, method, bucket)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s backup: %w", method, err))
+			continue
+		}
+		if err = store.Delete(ctx, backupBucket, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			errs = append(errs, fmt.Errorf("%s backup: %w", method, err))
+		}
+		if err = processing.InvalidateDerived(ctx, store, backupBucket, key); err != nil {
+			errs = append(errs, fmt.Errorf("%s backup: %w", method, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyLifecycle expires the objects of a bucket matching its rules. An
+// object matching several rules is expired by the first one.
+func applyLifecycle(ctx context.Context, primaryStore storage.Storage, bucket string, dryRun bool, report *lifecycleReport) error {
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	expired := map[string]bool{}
+
+	for _, rule := range bucketConfig.Lifecycle {
+		opts := &storage.ListOptions{Prefix: rule.Prefix, ContentTypes: rule.ContentType != ""}
+		for {
+			result, err := primaryStore.List(ctx, bucket, opts)
+			if err != nil {
+				return err
+			}
+			for _, object := range result.Objects {
+				if expired[object.Key] || !rule.Matches(object.Key, object.ContentType, object.LastModified, now) {
+					continue
+				}
+				etag := object.ETag
+				if len(rule.Metadata) > 0 {
+					info, err := primaryStore.Stat(ctx, bucket, object.Key)
+					if err != nil || !rule.MatchesMetadata(info.Metadata) {
+						continue
+					}
+					etag = info.ETag
+				}
+
+				expired[object.Key] = true
+				if !dryRun {
+					err = expireObject(ctx, primaryStore, bucket, object.Key, etag, rule.Backups)
+					if errors.Is(err, storage.ErrPreconditionFailed) {
+						// Written since it was listed, the new object is not expired
+						continue
+					}
+					if err != nil {
+						fmt.Println("!!! Lifecycle expiration failed: ", bucket, object.Key, " Error: ", err.Error())
+						report.Errors = append(report.Errors, bucket+"/"+object.Key+": "+err.Error())
+						continue
+					}
+				}
+				report.add(lifecycleExpiration{
+					Bucket:       bucket,
+					Key:          object.Key,
+					Rule:         rule.ID,
+					Size:         object.Size,
+					LastModified: object.LastModified,
+					Backups:      rule.Backups,
+				})
+			}
+			if result.Cursor == "" {
+				break
+			}
+			opts.Cursor = result.Cursor
+		}
+	}
+	return nil
+}
+
+// HandleApplyLifecycleTask applies the lifecycle rules and writes a report of
+// the expired objects (or the ones a dry run would expire) as the task result.
+func HandleApplyLifecycleTask(ctx context.Context, t *asynq.Task) error {
+	var payload queue.LifecycleJob
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	buckets := []string{payload.Bucket}
+	if payload.Bucket == "" {
+		var err error
+		if buckets, err = config.GetBuckets(); err != nil {
+			return err
+		}
+	}
+	primaryStore := backends.Primary()
+
+	fmt.Println("Starting lifecycle: ", payload.Bucket, "dry run:", payload.DryRun)
+
+	report := &lifecycleReport{DryRun: payload.DryRun, Expirations: []lifecycleExpiration{}}
+	errs := []error{}
+	for _, bucket := range buckets {
+		if err := applyLifecycle(ctx, primaryStore, bucket, payload.DryRun, report); err != nil {
+			fmt.Println("!!! Lifecycle failed: ", bucket, " Error: ", err.Error())
+			report.Errors = append(report.Errors, bucket+": "+err.Error())
+			errs = append(errs, err)
+		}
+	}
+
+	if data, err := json.Marshal(report); err == nil {
+		t.ResultWriter().Write(data)
+	}
+
+	fmt.Println("Lifecycle done: ", payload.Bucket, report.Objects, "objects")
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/optimizer"
+	"github.com/storage-gateway/src/processing"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+// withState returns a copy of metadata with the optimization state set.
+func withState(metadata map[string]string, state string) map[string]string {
+	metadata = maps.Clone(metadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata[storage.StateMetadata] = state
+	return metadata
+}
+
+// refreshMetadata replaces the technical metadata of an optimized object,
+// bodies that are not on disk are spooled for the extraction.
+func refreshMetadata(ctx context.Context, object *storage.PutObject) error {
+	body, ok := object.Body.(io.ReadSeeker)
+	if !ok {
+		return nil
+	}
+	defer body.Seek(0, io.SeekStart)
+
+	path := ""
+	if named, ok := object.Body.(interface{ Name() string }); ok {
+		path = named.Name()
+	} else {
+		spooled, err := os.CreateTemp("", "metadata-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spooled.Name())
+		defer spooled.Close()
+		if _, err = io.Copy(spooled, body); err != nil {
+			return err
+		}
+		path = spooled.Name()
+	}
+
+	extracted, err := processing.ExtractMetadata(ctx, path, object.ContentType)
+	if err != nil {
+		return err
+	}
+	maps.Copy(object.Metadata, extracted)
+	return nil
+}
+
+func optimizeObject(ctx context.Context, bucket string, key string, source *storage.GetObject, file *os.File, size int64, profileName string) error {
+	primaryStore := backends.Primary()
+	profile, err := config.GetOptimizationProfile(profileName)
+	if err != nil {
+		return err
+	}
+	bucketConfig, err := config.GetBucketConfig(bucket)
+	if err != nil {
+		return err
+	}
+
+	metadata := withState(source.Metadata, storage.StateOptimized)
+	if bucketConfig.KeepOriginals {
+		originalMetadata := maps.Clone(source.Metadata)
+		delete(originalMetadata, storage.StateMetadata)
+		err = primaryStore.Put(ctx, config.GetSafeEnv(config.InternalBucket), storage.OriginalKey(bucket, key), file, &storage.PutOptions{
+			ContentType:   source.ContentType,
+			Metadata:      originalMetadata,
+			ContentLength: size,
+			Profile:       config.DisabledProfile,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		metadata[storage.OriginalMetadata] = "true"
+	}
+
+	object, err := optimizer.Optimize(&storage.PutObject{
+		ContentType:   source.ContentType,
+		Metadata:      metadata,
+		ContentLength: size,
+		Body:          file,
+	}, profile)
+	if err != nil {
+		return err
+	}
+	if object.Body != io.Reader(file) {
+		if closer, ok := object.Body.(io.Closer); ok {
+			defer closer.Close()
+		}
+		// The optimized object has its own size, codecs and bitrate
+		if err = refreshMetadata(ctx, object); err != nil {
+			fmt.Println("!!! Metadata extraction failed: ", key, " Error: ", err.Error())
+		}
+	}
+
+	// Only replace the upload that was read, a newer upload of the key wins
+	return primaryStore.Put(ctx, bucket, key, object.Body, &storage.PutOptions{
+		ContentType:   object.ContentType,
+		Metadata:      object.Metadata,
+		ContentLength: object.ContentLength,
+		Profile:       config.DisabledProfile,
+		Conditions:    storage.Conditions{IfMatch: source.ETag},
+	})
+}
+
+// HandleOptimizeTask optimizes an object stored as uploaded and replaces it,
+// then schedules its backup and derived objects. After the last failed attempt
+// the upload is kept as is and marked failed.
+func HandleOptimizeTask(ctx context.Context, t *asynq.Task) error {
+	var payload queue.OptimizeJob
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	key, bucket := payload.Key, payload.Bucket
+	primaryStore := backends.Primary()
+
+	fmt.Println("Starting optimization: ", key)
+
+	source, err := primaryStore.Get(ctx, bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	defer source.Body.Close()
+	if source.Metadata[storage.StateMetadata] != storage.StateProcessing {
+		fmt.Println("Optimization skipped, object was replaced: ", key)
+		return nil
+	}
+
+	// Spool the upload, it is read again to keep the original or mark it failed
+	file, err := os.CreateTemp("", "optimize-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	size, err := io.Copy(file, source.Body)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	err = optimizeObject(ctx, bucket, key, source, file, size, payload.Profile)
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		fmt.Println("Optimization skipped, object was replaced: ", key)
+		return nil
+	}
+	if err != nil {
+		fmt.Println("!!! Optimization failed: ", key, " Error: ", err.Error())
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+		if retried < maxRetry {
+			return err
+		}
+		if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+			return err
+		}
+		markErr := primaryStore.Put(ctx, bucket, key, file, &storage.PutOptions{
+			ContentType:   source.ContentType,
+			Metadata:      withState(source.Metadata, storage.StateFailed),
+			ContentLength: size,
+			Profile:       config.DisabledProfile,
+			Conditions:    storage.Conditions{IfMatch: source.ETag},
+		})
+		if markErr == nil {
+			processing.ScheduleProcessing(bucket, key, source.ContentType)
+		}
+		return err
+	}
+
+	fmt.Println("Optimization done: ", key)
+
+	processing.ScheduleProcessing(bucket, key, source.ContentType)
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/optimizer"
+	"github.com/storage-gateway/src/processing"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+// reoptimizeObject replaces an object with its kept original optimized with
+// the profile, unless it was replaced since it was listed.
+func reoptimizeObject(ctx context.Context, bucket string, key string, profileName string) error {
+	primaryStore := backends.Primary()
+	profile, err := config.GetOptimizationProfile(profileName)
+	if err != nil {
+		return err
+	}
+	current, err := primaryStore.Stat(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	original, err := primaryStore.Get(ctx, config.GetSafeEnv(config.InternalBucket), storage.OriginalKey(bucket, key), nil)
+	if err != nil {
+		return err
+	}
+	defer original.Body.Close()
+
+	metadata := withState(original.Metadata, storage.StateOptimized)
+	metadata[storage.OriginalMetadata] = "true"
+	object, err := optimizer.Optimize(&storage.PutObject{
+		ContentType:   original.ContentType,
+		Metadata:      metadata,
+		ContentLength: original.ContentLength,
+		Body:          original.Body,
+	}, profile)
+	if err != nil {
+		return err
+	}
+	if object.Body != io.Reader(original.Body) {
+		if closer, ok := object.Body.(io.Closer); ok {
+			defer closer.Close()
+		}
+		if err = refreshMetadata(ctx, object); err != nil {
+			fmt.Println("!!! Metadata extraction failed: ", key, " Error: ", err.Error())
+		}
+	}
+
+	err = primaryStore.Put(ctx, bucket, key, object.Body, &storage.PutOptions{
+		ContentType:   object.ContentType,
+		Metadata:      object.Metadata,
+		ContentLength: object.ContentLength,
+		Profile:       config.DisabledProfile,
+		Conditions:    storage.Conditions{IfMatch: current.ETag},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Thumbnails, variants and renditions of the previous content are generated again
+	if err = processing.InvalidateDerived(ctx, primaryStore, bucket, key); err != nil {
+		fmt.Println("!!! Derived objects invalidation failed: ", key, " Error: ", err.Error())
+	}
+	if err = queue.EnqueueInvalidateDerived(queue.InvalidateDerivedJob{Key: key, Bucket: bucket}); err != nil {
+		fmt.Println("!!! Enqueueing derived objects invalidation failed: ", key, " Error: ", err.Error())
+	}
+	processing.ScheduleProcessing(bucket, key, original.ContentType)
+	return nil
+}
+
+// HandleReoptimizeTask replaces the objects under the job's prefix with their
+// kept originals optimized again.
+func HandleReoptimizeTask(ctx context.Context, t *asynq.Task) error {
+	var payload queue.ReoptimizeJob
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	bucket := payload.Bucket
+	profile := payload.Profile
+	if profile == "" {
+		bucketConfig, err := config.GetBucketConfig(bucket)
+		if err != nil {
+			return err
+		}
+		profile = bucketConfig.Profile
+	}
+	primaryStore := backends.Primary()
+	originalsPrefix := storage.OriginalKey(bucket, "")
+
+	fmt.Println("Starting re-optimization: ", bucket, payload.Prefix)
+
+	opts := &storage.ListOptions{Prefix: storage.OriginalKey(bucket, payload.Prefix)}
+	count := 0
+	for {
+		result, err := primaryStore.List(ctx, config.GetSafeEnv(config.InternalBucket), opts)
+		if err != nil {
+			return err
+		}
+		for _, object := range result.Objects {
+			key := strings.TrimPrefix(object.Key, originalsPrefix)
+			err = reoptimizeObject(ctx, bucket, key, profile)
+			if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrPreconditionFailed) {
+				fmt.Println("Re-optimization skipped, object was deleted or replaced: ", key)
+				continue
+			}
+			if err != nil {
+				fmt.Println("!!! Re-optimization failed: ", key, " Error: ", err.Error())
+				continue
+			}
+			count++
+		}
+		if result.Cursor == "" {
+			break
+		}
+		opts.Cursor = result.Cursor
+	}
+
+	fmt.Println("Re-optimization done: ", bucket, payload.Prefix, count, "objects")
+
+	return nil
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/storage-gateway/src/processing"
 	"github.com/storage-gateway/src/queue"
 	"github.com/storage-gateway/src/storage"
-	"github.com/storage-gateway/src/storage/s3_store"
+	"github.com/storage-gateway/src/storage/backends"
 )
 
 func HandleGenerateThumbTask(ctx context.Context, t *asynq.Task) error {
@@ -19,11 +19,11 @@ func HandleGenerateThumbTask(ctx context.Context, t *asynq.Task) error {
 	}
 	key, bucket := payload.Key, payload.Bucket
 	thumbKey := fmt.Sprintf("%s%s", key, processing.ThumbExt)
-	primaryStore := s3_store.GetPrimaryStore()
+	primaryStore := backends.Primary()
 
 	fmt.Println("Starting thumbnail generation: ", thumbKey)
 
-	videoFile, err := primaryStore.Get(ctx, bucket, key)
+	videoFile, err := primaryStore.Get(ctx, bucket, key, nil)
 	if err != nil {
 		return err
 	}
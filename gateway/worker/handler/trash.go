@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+func moveToTrash(ctx context.Context, store storage.Storage, bucket string, key string, trashKey string) error {
+	object, err := store.Get(ctx, bucket, key, nil)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer object.Body.Close()
+
+	err = store.Put(ctx, bucket, trashKey, object.Body, &storage.PutOptions{
+		ContentType:   object.ContentType,
+		Metadata:      object.Metadata,
+		ContentLength: object.ContentLength,
+		Profile:       config.DisabledProfile,
+	})
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, bucket, key)
+}
+
+// HandleTrashTask moves the backups of a deleted object to the trash of each
+// backup backend, where they stay until the trash is purged.
+func HandleTrashTask(ctx context.Context, t *asynq.Task) error {
+	var payload queue.TrashJob
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	key, bucket := payload.Key, payload.Bucket
+
+	fmt.Println("Starting trash: ", key)
+
+	creds, err := config.GetAvailableSecrets(bucket)
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, method := range creds {
+		store, backupBucket, err := backends.BackupStore(ctx, method, bucket)
+		if err == nil {
+			err = moveToTrash(ctx, store, backupBucket, key, storage.TrashKey(bucket, key))
+		}
+		if err != nil {
+			fmt.Println("!!! Trash failed: ", method, key, " Error: ", err.Error())
+			errs = append(errs, err)
+		}
+	}
+
+	fmt.Println("Trash done: ", key)
+
+	return errors.Join(errs...)
+}
+
+// purgeExpired deletes the objects under prefix last written before cutoff
+// and returns their keys relative to prefix.
+func purgeExpired(ctx context.Context, store storage.Storage, bucket string, prefix string, cutoff time.Time) ([]string, error) {
+	purged := []string{}
+	opts := &storage.ListOptions{Prefix: prefix}
+	for {
+		result, err := store.List(ctx, bucket, opts)
+		if err != nil {
+			return purged, err
+		}
+		for _, object := range result.Objects {
+			if !object.LastModified.Before(cutoff) {
+				continue
+			}
+			if err = store.Delete(ctx, bucket, object.Key); err != nil {
+				return purged, err
+			}
+			purged = append(purged, strings.TrimPrefix(object.Key, prefix))
+		}
+		if result.Cursor == "" {
+			break
+		}
+		opts.Cursor = result.Cursor
+	}
+	return purged, nil
+}
+
+// HandlePurgeTrashTask permanently deletes the trashed objects older than
+// their bucket's retention, from the backups first and then from the internal
+// bucket, so a failed run is retried from the entries left behind.
+func HandlePurgeTrashTask(ctx context.Context, t *asynq.Task) error {
+	buckets, err := config.GetBuckets()
+	if err != nil {
+		return err
+	}
+	primaryStore := backends.Primary()
+	internalBucket := config.GetSafeEnv(config.InternalBucket)
+
+	fmt.Println("Starting trash purge")
+
+	errs := []error{}
+	for _, bucket := range buckets {
+		bucketConfig, err := config.GetBucketConfig(bucket)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		cutoff := time.Now().Add(-bucketConfig.GetTrashRetention())
+		prefix := storage.TrashPrefix(bucket)
+
+		creds, err := config.GetAvailableSecrets(bucket)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, method := range creds {
+			store, backupBucket, err := backends.BackupStore(ctx, method, bucket)
+			if err == nil {
+				_, err = purgeExpired(ctx, store, backupBucket, prefix, cutoff)
+			}
+			if err != nil {
+				fmt.Println("!!! Trash purge failed: ", method, bucket, " Error: ", err.Error())
+				errs = append(errs, err)
+			}
+		}
+
+		purged, err := purgeExpired(ctx, primaryStore, internalBucket, prefix, cutoff)
+		if err != nil {
+			fmt.Println("!!! Trash purge failed: ", bucket, " Error: ", err.Error())
+			errs = append(errs, err)
+		}
+		for _, key := range purged {
+			// Kept originals outlive the object while it can be undeleted
+			if exists, err := primaryStore.Exists(ctx, bucket, key); err == nil && !exists {
+				primaryStore.Delete(ctx, internalBucket, storage.OriginalKey(bucket, key))
+			}
+		}
+		if len(purged) > 0 {
+			fmt.Println("Trash purged: ", bucket, len(purged), "objects")
+		}
+	}
+
+	fmt.Println("Trash purge done")
+
+	return errors.Join(errs...)
+}
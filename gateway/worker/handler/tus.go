@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+	"github.com/storage-gateway/src/storage/s3_store"
+)
+
+const tusPrefix = "tus/"
+
+// tusUpload holds the fields of the gateway's resumable upload state the
+// reaper needs, read from tus/<id>.info in the internal bucket.
+type tusUpload struct {
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	UploadID  string    `json:"uploadId,omitempty"`
+}
+
+func readTusUpload(ctx context.Context, primaryStore *s3_store.Filer, infoKey string) (*tusUpload, error) {
+	object, err := primaryStore.Get(ctx, config.GetSafeEnv(config.InternalBucket), infoKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+	upload := &tusUpload{}
+	return upload, json.NewDecoder(object.Body).Decode(upload)
+}
+
+// reapUpload aborts the multipart upload of an expired resumable upload and
+// deletes its state, the state last so a failed run is retried.
+func reapUpload(ctx context.Context, primaryStore *s3_store.Filer, id string, upload *tusUpload) error {
+	internalBucket := config.GetSafeEnv(config.InternalBucket)
+	if upload.UploadID != "" {
+		err := primaryStore.AbortMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	if err := primaryStore.Delete(ctx, internalBucket, tusPrefix+id+".part"); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return primaryStore.Delete(ctx, internalBucket, tusPrefix+id+".info")
+}
+
+// HandleReapUploadsTask removes the resumable uploads past their expiration:
+// their multipart upload is aborted and their state and pending chunk are
+// deleted. Pending chunks left without state are deleted once they are older
+// than TUS_EXPIRATION.
+func HandleReapUploadsTask(ctx context.Context, t *asynq.Task) error {
+	expiration, err := time.ParseDuration(config.GetSafeEnv(config.TusExpiration))
+	if err != nil {
+		return err
+	}
+	primaryStore := backends.Primary()
+	internalBucket := config.GetSafeEnv(config.InternalBucket)
+	now := time.Now()
+
+	fmt.Println("Starting upload reaping")
+
+	infos := map[string]bool{}
+	parts := map[string]time.Time{}
+	opts := &storage.ListOptions{Prefix: tusPrefix}
+	for {
+		result, err := primaryStore.List(ctx, internalBucket, opts)
+		if err != nil {
+			return err
+		}
+		for _, object := range result.Objects {
+			name := strings.TrimPrefix(object.Key, tusPrefix)
+			if id, ok := strings.CutSuffix(name, ".info"); ok {
+				infos[id] = true
+			} else if id, ok := strings.CutSuffix(name, ".part"); ok {
+				parts[id] = object.LastModified
+			}
+		}
+		if result.Cursor == "" {
+			break
+		}
+		opts.Cursor = result.Cursor
+	}
+
+	errs := []error{}
+	count := 0
+	for id := range infos {
+		upload, err := readTusUpload(ctx, primaryStore, tusPrefix+id+".info")
+		if errors.Is(err, storage.ErrNotFound) {
+			// Completed or terminated meanwhile
+			continue
+		}
+		if err == nil && now.Before(upload.ExpiresAt) {
+			continue
+		}
+		if err == nil {
+			err = reapUpload(ctx, primaryStore, id, upload)
+		}
+		if err != nil {
+			fmt.Println("!!! Upload reaping failed: ", id, " Error: ", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+		count++
+	}
+	for id, modified := range parts {
+		if infos[id] || now.Sub(modified) < expiration {
+			continue
+		}
+		if err := primaryStore.Delete(ctx, internalBucket, tusPrefix+id+".part"); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			errs = append(errs, err)
+		}
+	}
+
+	fmt.Println("Upload reaping done: ", count, "uploads")
+
+	return errors.Join(errs...)
+}
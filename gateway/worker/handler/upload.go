@@ -1,18 +1,14 @@
 package handler
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"time"
 
 	"github.com/hibiken/asynq"
 	"github.com/storage-gateway/src/processing"
 	"github.com/storage-gateway/src/queue"
-	"github.com/storage-gateway/src/storage"
-	"github.com/storage-gateway/src/storage/s3_store"
+	"github.com/storage-gateway/src/storage/backends"
 )
 
 func HandleUploadTask(ctx context.Context, t *asynq.Task) error {
@@ -21,31 +17,18 @@ func HandleUploadTask(ctx context.Context, t *asynq.Task) error {
 		return err
 	}
 	key, bucket, method := payload.Key, payload.Bucket, payload.Method
-	primaryStore := s3_store.GetPrimaryStore()
+	primaryStore := backends.Primary()
 
 	fmt.Println("Starting copy upload: ", key)
 
-	object, err := processing.GetBackup(ctx, method, bucket, key)
-	if err != nil {
-		return err
-	}
-	data, err := io.ReadAll(object.Body)
+	object, err := processing.GetBackup(ctx, method, bucket, key, nil)
 	if err != nil {
 		return err
 	}
 	defer object.Body.Close()
 
-	if object.Metadata == nil {
-		object.Metadata = map[string]string{}
-	}
-	object.Metadata["original-upload-date"] = object.LastModified.Format(time.RFC1123)
-
-	err = primaryStore.Put(ctx, bucket, key, bytes.NewReader(data), &storage.PutOptions{
-		ContentType:   object.ContentType,
-		Metadata:      object.Metadata,
-		ContentLength: int64(len(data)),
-	})
-
+	// Streamed, and only while the key is free so a newer upload is kept
+	err = backends.RestoreObject(ctx, primaryStore, bucket, key, object)
 	if err != nil {
 		fmt.Println("!!! Copy upload failed: ", key, " Error: ", err.Error())
 	} else {
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/hibiken/asynq"
+	"github.com/storage-gateway/src/config"
+	"github.com/storage-gateway/src/optimizer"
+	"github.com/storage-gateway/src/processing"
+	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage"
+	"github.com/storage-gateway/src/storage/backends"
+)
+
+func HandleGenerateVariantsTask(ctx context.Context, t *asynq.Task) error {
+	var payload queue.GenerateVariantsJob
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return err
+	}
+	key, bucket := payload.Key, payload.Bucket
+	primaryStore := backends.Primary()
+
+	fmt.Println("Starting variant generation: ", key)
+
+	original, err := primaryStore.Get(ctx, bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	defer original.Body.Close()
+
+	data, err := io.ReadAll(original.Body)
+	if err != nil {
+		return err
+	}
+
+	quality := optimizer.DefaultQuality
+	if bucketConfig, err := config.GetBucketConfig(bucket); err == nil {
+		if profile, err := config.GetOptimizationProfile(bucketConfig.Profile); err == nil && profile.Image.Quality > 0 {
+			quality = profile.Image.Quality
+		}
+	}
+
+	for _, format := range processing.VariantFormats {
+		variant, err := optimizer.ImageVariant(bytes.NewReader(data), format, quality)
+		if err != nil {
+			fmt.Println("!!! Variant generation failed: ", key, format, " Error: ", err.Error())
+			continue
+		}
+		// A variant that is not smaller than the original is never worth serving
+		if variant.ContentLength >= int64(len(data)) {
+			continue
+		}
+		err = primaryStore.Put(ctx, bucket, processing.VariantKey(key, format), variant.Body, &storage.PutOptions{
+			ContentType:   variant.ContentType,
+			Metadata:      variant.Metadata,
+			ContentLength: variant.ContentLength,
+		})
+		if err != nil {
+			fmt.Println("!!! Variant generation failed: ", key, format, " Error: ", err.Error())
+		}
+	}
+
+	fmt.Println("Variant generation done: ", key)
+
+	return nil
+}
@@ -1,21 +1,31 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/davidbyttow/govips/v2/vips"
 	"github.com/hibiken/asynq"
 	"github.com/storage-gateway/src/config"
 	"github.com/storage-gateway/src/queue"
+	"github.com/storage-gateway/src/storage/backends"
 	"github.com/storage-gateway/worker/handler"
 )
 
 func main() {
 	vips.Startup(nil)
 	defer vips.Shutdown()
+	// Handlers enqueue follow-up tasks such as backups of re-optimized objects
+	asyncClient := queue.InitQueue()
+	defer asyncClient.Close()
+	// Backup clients are shared by the tasks and rebuilt when their credentials change
+	ctx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go backends.WatchSecrets(ctx)
 
+	redisOpt := asynq.RedisClientOpt{Addr: config.GetSafeEnv(config.AsynqRedisUrl)}
 	srv := asynq.NewServer(
-		asynq.RedisClientOpt{Addr: config.GetSafeEnv(config.AsynqRedisUrl)},
+		redisOpt,
 		asynq.Config{
 			Concurrency: 5,
 			Queues: map[string]int{
@@ -29,6 +39,30 @@ func main() {
 	mux.HandleFunc(queue.TypeUploadFile, handler.HandleUploadTask)
 	mux.HandleFunc(queue.TypeDeleteFile, handler.HandleDeleteTask)
 	mux.HandleFunc(queue.TypeGenerateThumb, handler.HandleGenerateThumbTask)
+	mux.HandleFunc(queue.TypeGenerateVariants, handler.HandleGenerateVariantsTask)
+	mux.HandleFunc(queue.TypeReoptimize, handler.HandleReoptimizeTask)
+	mux.HandleFunc(queue.TypeOptimizeFile, handler.HandleOptimizeTask)
+	mux.HandleFunc(queue.TypeGenerateHLS, handler.HandleGenerateHLSTask)
+	mux.HandleFunc(queue.TypeTrashFile, handler.HandleTrashTask)
+	mux.HandleFunc(queue.TypePurgeTrash, handler.HandlePurgeTrashTask)
+	mux.HandleFunc(queue.TypeApplyLifecycle, handler.HandleApplyLifecycleTask)
+	mux.HandleFunc(queue.TypeEvictPrimary, handler.HandleEvictPrimaryTask)
+	mux.HandleFunc(queue.TypeReapUploads, handler.HandleReapUploadsTask)
+	mux.HandleFunc(queue.TypeInvalidateDerived, handler.HandleInvalidateDerivedTask)
+
+	// Every worker schedules the periodic tasks, each run is enqueued once
+	if err := queue.Schedule(ctx, config.GetSafeEnv(config.TrashPurgeSchedule), queue.PurgeTrashTask()); err != nil {
+		log.Fatal(err)
+	}
+	if err := queue.Schedule(ctx, config.GetSafeEnv(config.LifecycleSchedule), queue.ApplyLifecycleTask()); err != nil {
+		log.Fatal(err)
+	}
+	if err := queue.Schedule(ctx, config.GetSafeEnv(config.EvictionSchedule), queue.EvictPrimaryTask()); err != nil {
+		log.Fatal(err)
+	}
+	if err := queue.Schedule(ctx, config.GetSafeEnv(config.TusReapSchedule), queue.ReapUploadsTask()); err != nil {
+		log.Fatal(err)
+	}
 
 	if err := srv.Run(mux); err != nil {
 		log.Fatal(err)